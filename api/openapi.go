@@ -0,0 +1,57 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/tez-capital/protocol-rewards/constants"
+)
+
+//go:embed openapi.json
+var openApiTemplate []byte
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>protocol-rewards API</title>
+	<meta charset="utf-8"/>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+	<redoc spec-url="/openapi.json"></redoc>
+	<script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+var openApiSpec = sync.OnceValues(func() ([]byte, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(openApiTemplate, &spec); err != nil {
+		return nil, err
+	}
+	if info, ok := spec["info"].(map[string]interface{}); ok {
+		info["version"] = constants.VERSION
+	}
+	return json.Marshal(spec)
+})
+
+func registerOpenApi(app *fiber.App) {
+	app.Get("/openapi.json", func(c *fiber.Ctx) error {
+		spec, err := openApiSpec()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(spec)
+	})
+
+	app.Get("/docs", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(docsPage)
+	})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/constants"
+)
+
+var pathParamRegex = regexp.MustCompile(`:(\w+)`)
+
+func TestOpenApiDocumentsAllRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	spec, err := openApiSpec()
+	assert.Nil(err)
+
+	var document struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	assert.Nil(json.Unmarshal(spec, &document))
+	assert.Equal(constants.VERSION, document.Info.Version)
+
+	app := fiber.New()
+	registerPublicRoutes(app, nil)
+	registerPrivateRoutes(app, nil)
+
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		path := pathParamRegex.ReplaceAllString(route.Path, "{$1}")
+		operations, ok := document.Paths[path]
+		if !assert.True(ok, "route %s is not documented", path) {
+			continue
+		}
+		_, ok = operations[strings.ToLower(route.Method)]
+		assert.True(ok, "method %s of route %s is not documented", route.Method, path)
+	}
+}
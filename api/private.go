@@ -19,7 +19,8 @@ func registerFetchCycle(app *fiber.App, engine *core.Engine) {
 			})
 		}
 
-		go engine.FetchCycleDelegationStates(c.Context(), cycle, 0, &core.FetchOptions{
+		// request context is released once the handler returns, fetch lives with the engine
+		go engine.FetchCycleDelegationStates(engine.Context(), cycle, 0, &core.FetchOptions{
 			Force: c.Query("force") == "true",
 		})
 		return c.JSON(fiber.Map{
@@ -44,7 +45,7 @@ func registerFetchDelegate(app *fiber.App, engine *core.Engine) {
 			})
 		}
 
-		go engine.FetchDelegateDelegationState(c.Context(), address, cycle, 0, &core.FetchOptions{
+		go engine.FetchDelegateDelegationState(engine.Context(), address, cycle, 0, &core.FetchOptions{
 			Force: c.Query("force") == "true",
 		})
 		return c.JSON(fiber.Map{
@@ -54,13 +55,44 @@ func registerFetchDelegate(app *fiber.App, engine *core.Engine) {
 	})
 }
 
+func registerFetchAudit(app *fiber.App, engine *core.Engine) {
+	app.Get("/audit/delegate/:cycle/:address", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		audits, err := engine.GetFetchAudits(address, cycle)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(audits)
+	})
+}
+
+func registerPrivateRoutes(app *fiber.App, engine *core.Engine) {
+	registerFetchCycle(app, engine)
+	registerFetchDelegate(app, engine)
+	registerFetchAudit(app, engine)
+}
+
 func CreatePrivateApi(config *configuration.Runtime, engine *core.Engine) *fiber.App {
 	if config.PrivateListen == "" {
 		return nil
 	}
-	app := fiber.New()
-	registerFetchCycle(app, engine)
-	registerFetchDelegate(app, engine)
+	app := newApp(config)
+	registerPrivateRoutes(app, engine)
 
 	go func() {
 		err := app.Listen(config.PrivateListen)
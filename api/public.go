@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"strconv"
@@ -8,10 +9,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/samber/lo"
+	"github.com/tez-capital/protocol-rewards/common"
 	"github.com/tez-capital/protocol-rewards/configuration"
 	"github.com/tez-capital/protocol-rewards/constants"
 	"github.com/tez-capital/protocol-rewards/core"
-	"github.com/tez-capital/protocol-rewards/store"
 	"github.com/trilitech/tzgo/tezos"
 )
 
@@ -31,7 +33,18 @@ func registerGetDelegationState(app *fiber.App, engine *core.Engine) {
 			})
 		}
 
-		state, err := engine.GetDelegationState(c.Context(), address, cycle)
+		var state *common.StoredDelegationState
+		if c.Query("version") != "" {
+			version, err := strconv.ParseInt(c.Query("version"), 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			state, err = engine.GetDelegationStateVersion(c.Context(), address, cycle, version)
+		} else {
+			state, err = engine.GetDelegationState(c.Context(), address, cycle)
+		}
 		if err != nil {
 			if errors.Is(err, constants.ErrNotFound) {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -47,6 +60,277 @@ func registerGetDelegationState(app *fiber.App, engine *core.Engine) {
 	})
 }
 
+func registerGetDelegationStateVersions(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/:cycle/:address/versions", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		versions, err := engine.GetDelegationStateVersions(c.Context(), address, cycle)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(versions)
+	})
+}
+
+func registerGetDelegationStateVersionDiff(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/:cycle/:address/versions/diff/:versionA/:versionB", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		versionA, err := strconv.ParseInt(c.Params("versionA"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		versionB, err := strconv.ParseInt(c.Params("versionB"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		diff, err := engine.GetDelegationStateVersionDiff(c.Context(), address, cycle, versionA, versionB)
+		if err != nil {
+			if errors.Is(err, constants.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Delegation state version not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(diff)
+	})
+}
+
+// deduplicated delegates and cycles of a batch query, limits apply after deduplication
+func delegationStatesQueryTargets(cycle int64, request *common.DelegationStatesQuery) ([]tezos.Address, []int64, error) {
+	delegates := lo.Uniq(request.Delegates)
+	if len(delegates) > constants.MAX_BATCH_QUERY_DELEGATES {
+		return nil, nil, constants.ErrTooManyDelegatesRequested
+	}
+
+	cycles := []int64{cycle}
+	for _, cycleRange := range request.Cycles {
+		if cycleRange.From > cycleRange.To {
+			return nil, nil, constants.ErrInvalidCycleRange
+		}
+		if cycleRange.To-cycleRange.From >= constants.MAX_BATCH_QUERY_CYCLES {
+			return nil, nil, constants.ErrTooManyCyclesRequested
+		}
+		for cycle := cycleRange.From; cycle <= cycleRange.To; cycle++ {
+			cycles = append(cycles, cycle)
+		}
+	}
+	cycles = lo.Uniq(cycles)
+	if len(cycles) > constants.MAX_BATCH_QUERY_CYCLES {
+		return nil, nil, constants.ErrTooManyCyclesRequested
+	}
+	return delegates, cycles, nil
+}
+
+func registerGetDelegationStates(app *fiber.App, engine *core.Engine) {
+	app.Post("/delegates/:cycle", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		var request common.DelegationStatesQuery
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		delegates, cycles, err := delegationStatesQueryTargets(cycle, &request)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		states, err := engine.GetDelegationStates(c.Context(), delegates, cycles)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(states)
+	})
+}
+
+func registerGetDelegationStateHistory(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/:address/history", func(c *fiber.Ctx) error {
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		to, err := strconv.ParseInt(c.Query("to"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		if from > to {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": constants.ErrInvalidCycleRange.Error(),
+			})
+		}
+		if to-from >= constants.MAX_HISTORY_CYCLES {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": constants.ErrTooManyCyclesRequested.Error(),
+			})
+		}
+
+		history, err := engine.GetDelegationStateHistory(c.Context(), address, from, to)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(history)
+	})
+}
+
+func registerGetDelegationStateDiff(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/:address/diff/:cycleA/:cycleB", func(c *fiber.Ctx) error {
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		cycleA, err := strconv.ParseInt(c.Params("cycleA"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		cycleB, err := strconv.ParseInt(c.Params("cycleB"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		diff, err := engine.GetDelegationStateDiff(c.Context(), address, cycleA, cycleB)
+		if err != nil {
+			if errors.Is(err, constants.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Delegation state not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(diff)
+	})
+}
+
+func registerGetUpcomingCycles(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/:address/upcoming", func(c *fiber.Ctx) error {
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		upcoming, err := engine.GetUpcomingCycles(c.Context(), address)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(upcoming)
+	})
+}
+
+func registerGetDelegationStatePreview(app *fiber.App, engine *core.Engine) {
+	app.Get("/delegate/current/:address/preview", func(c *fiber.Ctx) error {
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		preview, err := engine.GetDelegationStatePreview(c.Context(), address)
+		if err != nil {
+			switch {
+			case errors.Is(err, constants.ErrNotFound):
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Delegate not found",
+				})
+			case errors.Is(err, constants.ErrTooManyPreviewComputations):
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			case errors.Is(err, constants.ErrEngineOffline):
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(preview)
+	})
+}
+
 func registerIsDelegationStateAvailable(app *fiber.App, engine *core.Engine) {
 	app.Get("/delegate/:cycle/:address/available", func(c *fiber.Ctx) error {
 		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
@@ -74,6 +358,26 @@ func registerIsDelegationStateAvailable(app *fiber.App, engine *core.Engine) {
 	})
 }
 
+func registerGetStakerLedger(app *fiber.App, engine *core.Engine) {
+	app.Get("/staker/:address", func(c *fiber.Ctx) error {
+		address, err := tezos.ParseAddress(c.Params("address"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		ledger, err := engine.GetStakerLedger(c.Context(), address)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(ledger)
+	})
+}
+
 func registerStatistics(app *fiber.App, engine *core.Engine) {
 	app.Get("/statistics/:cycle", func(c *fiber.Ctx) error {
 		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
@@ -123,28 +427,137 @@ func registerRewardsSplitMirror(app *fiber.App, engine *core.Engine) {
 		}
 
 		switch state.Status {
-		case store.DelegationStateStatusMinimumNotAvailable:
+		case common.DelegationStateStatusMinimumNotAvailable:
 			return c.Status(fiber.StatusNoContent).JSON(fiber.Map{
-				"error": "relevant minimum does not exists",
+				"error": constants.ErrMinimumNotAvailable.Error(),
 			})
+		case common.DelegationStateStatusDeactivated:
+			return rewardsSplitStatusError(c, fiber.StatusGone, constants.ErrDelegateDeactivated, state)
+		case common.DelegationStateStatusNotRegistered:
+			return rewardsSplitStatusError(c, fiber.StatusUnprocessableEntity, constants.ErrDelegateNotRegistered, state)
+		case common.DelegationStateStatusZeroBalance:
+			return rewardsSplitStatusError(c, fiber.StatusConflict, constants.ErrDelegateHasZeroBalance, state)
+		case common.DelegationStateStatusPartial:
+			// refetched until all balances are available
+			return rewardsSplitStatusError(c, fiber.StatusServiceUnavailable, constants.ErrFailedToFetchContractBalances, state)
 		}
 
 		return c.JSON(state.ToTzktState())
 	})
 }
 
+// states which can not be served as a split, reason carries the details collected with the state
+func rewardsSplitStatusError(c *fiber.Ctx, code int, err error, state *common.StoredDelegationState) error {
+	return c.Status(code).JSON(fiber.Map{
+		"error":  err.Error(),
+		"status": state.Status.QueryStatus(),
+		"reason": state.StatusReason,
+	})
+}
+
+func registerNetworkStatistics(app *fiber.App, engine *core.Engine) {
+	app.Get("/statistics/:cycle/network", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		statistics, err := engine.NetworkStatistics(c.Context(), cycle)
+		if err != nil {
+			if errors.Is(err, constants.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Statistics not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(statistics)
+	})
+}
+
+func registerPublicRoutes(app *fiber.App, engine *core.Engine) {
+	registerGetDelegationStateHistory(app, engine)
+	registerGetDelegationStateDiff(app, engine)
+	registerGetDelegationStatePreview(app, engine)
+	registerGetUpcomingCycles(app, engine)
+	registerGetDelegationState(app, engine)
+	registerGetDelegationStateVersions(app, engine)
+	registerGetDelegationStateVersionDiff(app, engine)
+	registerGetDelegationStates(app, engine)
+	registerIsDelegationStateAvailable(app, engine)
+	registerRewardsSplitMirror(app, engine)
+	registerGetStakerLedger(app, engine)
+	registerStatistics(app, engine)
+	registerNetworkStatistics(app, engine)
+	registerCycleStatus(app, engine)
+	registerHealth(app, engine)
+	registerOpenApi(app)
+}
+
+// implemented by core.Engine
+type cycleFetchStatusSource interface {
+	GetCycleFetchStatus(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error)
+}
+
+func registerCycleStatus(app *fiber.App, engine cycleFetchStatusSource) {
+	app.Get("/cycle/:cycle/status", func(c *fiber.Ctx) error {
+		cycle, err := strconv.ParseInt(c.Params("cycle"), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		status, err := engine.GetCycleFetchStatus(c.Context(), cycle)
+		if err != nil {
+			if errors.Is(err, constants.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Cycle fetch not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(status)
+	})
+}
+
+func registerHealth(app *fiber.App, engine *core.Engine) {
+	app.Get("/health", func(c *fiber.Ctx) error {
+		health := engine.Health()
+		if health.ShuttingDown {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(health)
+		}
+		return c.JSON(health)
+	})
+}
+
+// numeric_amounts changes only the encoding of responses, stored and signed data keep amounts as strings
+func newApp(config *configuration.Runtime) *fiber.App {
+	if !config.NumericAmounts {
+		return fiber.New()
+	}
+	return fiber.New(fiber.Config{
+		JSONEncoder: common.MarshalNumericAmountsJSON,
+	})
+}
+
 func CreatePublicApi(config *configuration.Runtime, engine *core.Engine) *fiber.App {
-	app := fiber.New()
+	app := newApp(config)
 
 	app.Use(limiter.New(limiter.Config{
 		Max:        10,
 		Expiration: 30 * time.Second,
 	}))
 
-	registerGetDelegationState(app, engine)
-	registerIsDelegationStateAvailable(app, engine)
-	registerRewardsSplitMirror(app, engine)
-	registerStatistics(app, engine)
+	registerPublicRoutes(app, engine)
 
 	go func() {
 		err := app.Listen(config.Listen)
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/configuration"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestDelegationStatesQueryTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	other := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+
+	delegates, cycles, err := delegationStatesQueryTargets(750, &common.DelegationStatesQuery{
+		Delegates: []tezos.Address{baker, other, baker},
+		Cycles:    []common.CycleRange{{From: 748, To: 751}, {From: 750, To: 750}},
+	})
+	assert.Nil(err)
+	assert.Equal([]tezos.Address{baker, other}, delegates)
+	assert.Equal([]int64{750, 748, 749, 751}, cycles)
+
+	// duplicates do not count against the limit
+	duplicates := make([]tezos.Address, constants.MAX_BATCH_QUERY_DELEGATES+1)
+	for i := range duplicates {
+		duplicates[i] = baker
+	}
+	delegates, _, err = delegationStatesQueryTargets(750, &common.DelegationStatesQuery{Delegates: duplicates})
+	assert.Nil(err)
+	assert.Len(delegates, 1)
+
+	_, _, err = delegationStatesQueryTargets(750, &common.DelegationStatesQuery{Delegates: []tezos.Address{baker}, Cycles: []common.CycleRange{{From: 751, To: 750}}})
+	assert.ErrorIs(err, constants.ErrInvalidCycleRange)
+
+	_, _, err = delegationStatesQueryTargets(750, &common.DelegationStatesQuery{Cycles: []common.CycleRange{{From: 700, To: 700 + constants.MAX_BATCH_QUERY_CYCLES}}})
+	assert.ErrorIs(err, constants.ErrTooManyCyclesRequested)
+
+	// every range is within the limit but together they exceed it
+	_, _, err = delegationStatesQueryTargets(750, &common.DelegationStatesQuery{Cycles: []common.CycleRange{
+		{From: 600, To: 600 + constants.MAX_BATCH_QUERY_CYCLES/2},
+		{From: 700, To: 700 + constants.MAX_BATCH_QUERY_CYCLES/2},
+	}})
+	assert.ErrorIs(err, constants.ErrTooManyCyclesRequested)
+}
+
+func TestGetDelegationStatesRejectsTooManyDelegates(t *testing.T) {
+	assert := assert.New(t)
+
+	app := fiber.New()
+	registerGetDelegationStates(app, nil)
+
+	delegates := make([]string, 0, constants.MAX_BATCH_QUERY_DELEGATES+1)
+	for i := 0; i <= constants.MAX_BATCH_QUERY_DELEGATES; i++ {
+		delegates = append(delegates, tezos.NewAddress(tezos.AddressTypeEd25519, bytes.Repeat([]byte{byte(i), byte(i >> 8)}, 10)).String())
+	}
+	body, err := json.Marshal(map[string]any{"delegates": delegates})
+	assert.Nil(err)
+
+	request := httptest.NewRequest(fiber.MethodPost, "/delegates/750", bytes.NewReader(body))
+	request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	response, err := app.Test(request)
+	assert.Nil(err)
+	assert.Equal(fiber.StatusBadRequest, response.StatusCode)
+
+	var result map[string]string
+	assert.Nil(json.NewDecoder(response.Body).Decode(&result))
+	assert.Equal(constants.ErrTooManyDelegatesRequested.Error(), result["error"])
+}
+
+type cycleFetchStatusFunc func(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error)
+
+func (f cycleFetchStatusFunc) GetCycleFetchStatus(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error) {
+	return f(ctx, cycle)
+}
+
+func TestCycleStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	app := fiber.New()
+	registerCycleStatus(app, cycleFetchStatusFunc(func(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error) {
+		if cycle != 745 {
+			return nil, constants.ErrNotFound
+		}
+		return &common.CycleFetchStatus{Cycle: cycle, Finished: true, Expected: 2, Succeeded: 1, Failed: 1}, nil
+	}))
+
+	response, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/cycle/745/status", nil))
+	assert.Nil(err)
+	assert.Equal(fiber.StatusOK, response.StatusCode)
+	var status common.CycleFetchStatus
+	assert.Nil(json.NewDecoder(response.Body).Decode(&status))
+	assert.Equal(int64(745), status.Cycle)
+	assert.Equal(1, status.Failed)
+	assert.False(status.Complete)
+
+	response, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/cycle/744/status", nil))
+	assert.Nil(err)
+	assert.Equal(fiber.StatusNotFound, response.StatusCode)
+
+	response, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/cycle/latest/status", nil))
+	assert.Nil(err)
+	assert.Equal(fiber.StatusBadRequest, response.StatusCode)
+}
+
+func TestNumericAmountsResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	for numeric, expected := range map[bool]string{
+		false: `{"delegated_balance":"1000","overstaked_balance":"0","staked_balance":"-5"}`,
+		true:  `{"delegated_balance":1000,"overstaked_balance":0,"staked_balance":-5}`,
+	} {
+		app := newApp(&configuration.Runtime{NumericAmounts: numeric})
+		app.Get("/balances", func(c *fiber.Ctx) error {
+			return c.JSON(common.DelegatorBalances{DelegatedBalance: common.NewMutez(1000), StakedBalance: common.NewMutez(-5)})
+		})
+
+		response, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/balances", nil))
+		assert.Nil(err)
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(err)
+		assert.Equal(expected, string(body))
+	}
+}
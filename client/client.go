@@ -0,0 +1,293 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type ClientOptions struct {
+	// url of the private api, fetch triggers are not available without it
+	PrivateUrl string
+	HttpClient *http.Client
+}
+
+var (
+	DefaultClientOptions = &ClientOptions{
+		HttpClient: &http.Client{
+			Timeout: constants.HTTP_CLIENT_TIMEOUT_SECONDS * time.Second,
+		},
+	}
+)
+
+type Client struct {
+	url        string
+	privateUrl string
+	httpClient *http.Client
+}
+
+func NewClient(url string, options *ClientOptions) *Client {
+	if options == nil {
+		options = DefaultClientOptions
+	}
+	httpClient := options.HttpClient
+	if httpClient == nil {
+		httpClient = DefaultClientOptions.HttpClient
+	}
+
+	return &Client{
+		url:        strings.TrimSuffix(url, "/"),
+		privateUrl: strings.TrimSuffix(options.PrivateUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, baseUrl string, path string, body interface{}, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, baseUrl+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return 0, errors.Join(constants.ErrRequestFailed, err)
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNoContent:
+		return response.StatusCode, nil
+	case response.StatusCode/100 != 2:
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&apiError)
+		err := fmt.Errorf("%s %s: status %d: %s", method, path, response.StatusCode, apiError.Error)
+		if response.StatusCode == http.StatusNotFound {
+			return response.StatusCode, errors.Join(constants.ErrNotFound, err)
+		}
+		return response.StatusCode, errors.Join(constants.ErrRequestFailed, err)
+	}
+
+	if result == nil {
+		return response.StatusCode, nil
+	}
+	return response.StatusCode, json.NewDecoder(response.Body).Decode(result)
+}
+
+func (c *Client) get(ctx context.Context, path string, result interface{}) (int, error) {
+	return c.do(ctx, http.MethodGet, c.url, path, nil, result)
+}
+
+func (c *Client) GetDelegationState(ctx context.Context, delegate tezos.Address, cycle int64) (*common.StoredDelegationState, error) {
+	var state common.StoredDelegationState
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%d/%s", cycle, delegate), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (c *Client) GetDelegationStateVersion(ctx context.Context, delegate tezos.Address, cycle, version int64) (*common.StoredDelegationState, error) {
+	var state common.StoredDelegationState
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%d/%s?version=%d", cycle, delegate, version), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (c *Client) GetDelegationStateVersions(ctx context.Context, delegate tezos.Address, cycle int64) ([]common.DelegationStateVersionInfo, error) {
+	var result []common.DelegationStateVersionInfo
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%d/%s/versions", cycle, delegate), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) GetDelegationStateVersionDiff(ctx context.Context, delegate tezos.Address, cycle, versionA, versionB int64) (*common.DelegationStateVersionDiff, error) {
+	var result common.DelegationStateVersionDiff
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%d/%s/versions/diff/%d/%d", cycle, delegate, versionA, versionB), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetDelegationStates(ctx context.Context, cycle int64, query *common.DelegationStatesQuery) ([]common.DelegationStateQueryResult, error) {
+	var result []common.DelegationStateQueryResult
+	if _, err := c.do(ctx, http.MethodPost, c.url, fmt.Sprintf("/delegates/%d", cycle), query, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) GetDelegationStateHistory(ctx context.Context, delegate tezos.Address, fromCycle, toCycle int64) ([]common.DelegationStateHistoryEntry, error) {
+	var result []common.DelegationStateHistoryEntry
+	query := url.Values{}
+	query.Set("from", fmt.Sprint(fromCycle))
+	query.Set("to", fmt.Sprint(toCycle))
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%s/history?%s", delegate, query.Encode()), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) GetDelegationStateDiff(ctx context.Context, delegate tezos.Address, cycleA, cycleB int64) (*common.DelegationStateDiff, error) {
+	var result common.DelegationStateDiff
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%s/diff/%d/%d", delegate, cycleA, cycleB), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetUpcomingCycles(ctx context.Context, delegate tezos.Address) ([]common.UpcomingCycle, error) {
+	var result []common.UpcomingCycle
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%s/upcoming", delegate), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// provisional state of the running cycle, it changes until the cycle ends
+func (c *Client) GetDelegationStatePreview(ctx context.Context, delegate tezos.Address) (*common.DelegationStatePreview, error) {
+	var result common.DelegationStatePreview
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/current/%s/preview", delegate), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) IsAvailable(ctx context.Context, delegate tezos.Address, cycle int64) (bool, error) {
+	var available bool
+	if _, err := c.get(ctx, fmt.Sprintf("/delegate/%d/%s/available", cycle, delegate), &available); err != nil {
+		return false, err
+	}
+	return available, nil
+}
+
+func (c *Client) GetStakerLedger(ctx context.Context, staker tezos.Address) (*common.StakerLedger, error) {
+	var result common.StakerLedger
+	if _, err := c.get(ctx, fmt.Sprintf("/staker/%s", staker), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Statistics(ctx context.Context, cycle int64) (*common.CycleStatistics, error) {
+	var result common.CycleStatistics
+	if _, err := c.get(ctx, fmt.Sprintf("/statistics/%d", cycle), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) NetworkStatistics(ctx context.Context, cycle int64) (*common.NetworkCycleStatistics, error) {
+	var result common.NetworkCycleStatistics
+	if _, err := c.get(ctx, fmt.Sprintf("/statistics/%d/network", cycle), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// returns constants.ErrMinimumNotAvailable if the delegate had no relevant minimum in the cycle,
+// other states which can not be split are reported with the matching delegate error
+func (c *Client) RewardsSplit(ctx context.Context, delegate tezos.Address, cycle int64) (*common.TzktLikeDelegationState, error) {
+	var result common.TzktLikeDelegationState
+	status, err := c.get(ctx, fmt.Sprintf("/v1/rewards/split/%s/%d", delegate, cycle), &result)
+	switch {
+	case status == http.StatusGone:
+		return nil, errors.Join(constants.ErrDelegateDeactivated, err)
+	case status == http.StatusUnprocessableEntity:
+		return nil, errors.Join(constants.ErrDelegateNotRegistered, err)
+	case status == http.StatusConflict:
+		return nil, errors.Join(constants.ErrDelegateHasZeroBalance, err)
+	case status == http.StatusServiceUnavailable:
+		return nil, errors.Join(constants.ErrFailedToFetchContractBalances, err)
+	case err != nil:
+		return nil, err
+	}
+	if status == http.StatusNoContent {
+		return nil, constants.ErrMinimumNotAvailable
+	}
+	return &result, nil
+}
+
+func (c *Client) CycleStatus(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error) {
+	var result common.CycleFetchStatus
+	if _, err := c.get(ctx, fmt.Sprintf("/cycle/%d/status", cycle), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// health is returned even if the engine is shutting down
+func (c *Client) Health(ctx context.Context) (*common.EngineHealth, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Join(constants.ErrRequestFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusServiceUnavailable {
+		return nil, errors.Join(constants.ErrRequestFailed, fmt.Errorf("GET /health: status %d", response.StatusCode))
+	}
+
+	var result common.EngineHealth
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) FetchCycle(ctx context.Context, cycle int64, force bool) error {
+	if c.privateUrl == "" {
+		return constants.ErrPrivateApiNotConfigured
+	}
+	_, err := c.do(ctx, http.MethodGet, c.privateUrl, fmt.Sprintf("/fetch/cycle/%d?force=%t", cycle, force), nil, nil)
+	return err
+}
+
+func (c *Client) FetchDelegate(ctx context.Context, delegate tezos.Address, cycle int64, force bool) error {
+	if c.privateUrl == "" {
+		return constants.ErrPrivateApiNotConfigured
+	}
+	_, err := c.do(ctx, http.MethodGet, c.privateUrl, fmt.Sprintf("/fetch/delegate/%d/%s?force=%t", cycle, delegate, force), nil, nil)
+	return err
+}
+
+// fetches of the delegate in the cycle with their inputs and outcome, oldest first
+func (c *Client) GetFetchAudits(ctx context.Context, delegate tezos.Address, cycle int64) ([]common.StoredFetchAudit, error) {
+	if c.privateUrl == "" {
+		return nil, constants.ErrPrivateApiNotConfigured
+	}
+	var result []common.StoredFetchAudit
+	if _, err := c.do(ctx, http.MethodGet, c.privateUrl, fmt.Sprintf("/audit/delegate/%d/%s", cycle, delegate), nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+var (
+	defaultCtx = context.Background()
+	baker      = tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator  = tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /delegate/750/"+baker.String(), func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(common.StoredDelegationState{
+			Delegate: common.Address{Address: baker},
+			Cycle:    745,
+			Balances: common.DelegatedBalances{
+				delegator: {DelegatedBalance: common.NewMutez(100), StakedBalance: common.NewMutez(10)},
+			},
+		})
+	})
+	mux.HandleFunc("GET /delegate/751/"+baker.String(), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Delegation state not found"})
+	})
+	mux.HandleFunc("GET /v1/rewards/split/"+baker.String()+"/750", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /v1/rewards/split/"+baker.String()+"/751", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+		json.NewEncoder(w).Encode(map[string]string{"error": "delegate is deactivated", "status": "deactivated"})
+	})
+	mux.HandleFunc("POST /delegates/750", func(w http.ResponseWriter, r *http.Request) {
+		var query common.DelegationStatesQuery
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := make([]common.DelegationStateQueryResult, 0, len(query.Delegates))
+		for _, delegate := range query.Delegates {
+			result = append(result, common.DelegationStateQueryResult{
+				Delegate: delegate,
+				Cycle:    750,
+				Status:   common.DelegationStateQueryStatusNotFound,
+			})
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+	mux.HandleFunc("GET /fetch/cycle/750", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("force") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int64{"cycle": 750})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newTestServer()
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", nil)
+
+	state, err := client.GetDelegationState(defaultCtx, baker, 750)
+	assert.Nil(err)
+	assert.Equal(int64(745), state.Cycle)
+	assert.Equal(common.NewMutez(100), state.Balances[delegator].DelegatedBalance)
+
+	_, err = client.GetDelegationState(defaultCtx, baker, 751)
+	assert.True(errors.Is(err, constants.ErrNotFound))
+
+	_, err = client.RewardsSplit(defaultCtx, baker, 750)
+	assert.True(errors.Is(err, constants.ErrMinimumNotAvailable))
+	_, err = client.RewardsSplit(defaultCtx, baker, 751)
+	assert.True(errors.Is(err, constants.ErrDelegateDeactivated))
+	assert.True(errors.Is(err, constants.ErrRequestFailed))
+
+	states, err := client.GetDelegationStates(defaultCtx, 750, &common.DelegationStatesQuery{
+		Delegates: []tezos.Address{baker, delegator},
+	})
+	assert.Nil(err)
+	assert.Len(states, 2)
+	assert.Equal(delegator, states[1].Delegate)
+	assert.Equal(common.DelegationStateQueryStatusNotFound, states[1].Status)
+
+	assert.True(errors.Is(client.FetchCycle(defaultCtx, 750, true), constants.ErrPrivateApiNotConfigured))
+
+	privateClient := NewClient(server.URL, &ClientOptions{PrivateUrl: server.URL})
+	assert.Nil(privateClient.FetchCycle(defaultCtx, 750, true))
+	assert.True(errors.Is(privateClient.FetchCycle(defaultCtx, 750, false), constants.ErrRequestFailed))
+}
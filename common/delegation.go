@@ -49,7 +49,7 @@ type UnstakeRequests struct {
 	Unfinalizable UnfinalizableUnstakeRequests `json:"unfinalizable"`
 }
 
-func (u *UnstakeRequests) GetUnstakedTotalForBaker(baker tezos.Address) int64 {
+func (u *UnstakeRequests) GetUnstakedTotalForBaker(baker tezos.Address) Mutez {
 	total := tezos.Zero
 	for _, request := range u.Finalizable {
 		if request.Delegate.Equal(baker) {
@@ -61,10 +61,10 @@ func (u *UnstakeRequests) GetUnstakedTotalForBaker(baker tezos.Address) int64 {
 			total = total.Add(request.Amount)
 		}
 	}
-	return total.Int64()
+	return NewMutezFromZ(total)
 }
 
-func (u *UnstakeRequests) GetUnstakedTotal() int64 {
+func (u *UnstakeRequests) GetUnstakedTotal() Mutez {
 	total := tezos.Zero
 	for _, request := range u.Finalizable {
 		total = total.Add(request.Amount)
@@ -72,22 +72,43 @@ func (u *UnstakeRequests) GetUnstakedTotal() int64 {
 	for _, request := range u.Unfinalizable.Requests {
 		total = total.Add(request.Amount)
 	}
-	return total.Int64()
+	return NewMutezFromZ(total)
+}
+
+// kind of the delegator account, only implicit accounts can stake
+type AccountType string
+
+const (
+	AccountTypeImplicit AccountType = "implicit"
+	// smart contract (KT1)
+	AccountTypeOriginated AccountType = "originated"
+)
+
+func GetAccountType(address tezos.Address) AccountType {
+	switch {
+	case address.IsContract():
+		return AccountTypeOriginated
+	case address.IsEOA():
+		return AccountTypeImplicit
+	default:
+		return ""
+	}
 }
 
 type DelegatorBalances struct {
-	DelegatedBalance int64 `json:"delegated_balance"`
+	DelegatedBalance Mutez `json:"delegated_balance"`
 	// protion of staked balance included in delegated balance
-	OverstakedBalance int64 `json:"overstaked_balance"`
-	StakedBalance     int64 `json:"staked_balance"`
+	OverstakedBalance Mutez       `json:"overstaked_balance"`
+	StakedBalance     Mutez       `json:"staked_balance"`
+	AccountType       AccountType `json:"account_type,omitempty"`
 }
 
 type DelegatedBalances map[tezos.Address]DelegatorBalances
 
 type DelegationStateBalanceInfo struct {
-	Balance         int64         `json:"balance"`
-	StakedBalance   int64         `json:"frozen_deposits"`
-	UnstakedBalance int64         `json:"unfrozen_deposits"`
+	Balance         Mutez         `json:"balance"`
+	StakedBalance   Mutez         `json:"frozen_deposits"`
+	UnstakedBalance Mutez         `json:"unfrozen_deposits"`
 	Baker           tezos.Address `json:"delegate"`
 	// baker we stake with, can differ in case of delegation change
 	StakeBaker tezos.Address `json:"stake_baker"`
@@ -109,12 +130,30 @@ const (
 	CreatedOnDelegation CreationInfoKind = "delegation"
 )
 
+// strategy used to find the balance update matching the minimum delegated balance
+type MinimumSearchStrategy string
+
+const (
+	// balance updates in our default order, match within tolerance
+	MinimumSearchStrategyExact MinimumSearchStrategy = "exact"
+	// balance updates in the order reported by the node, without reordering of burns, deposits and block metadata
+	MinimumSearchStrategyNodeOrder MinimumSearchStrategy = "node_order"
+	// block metadata balance updates applied before operations
+	MinimumSearchStrategyMetadataFirst MinimumSearchStrategy = "metadata_first"
+	// the closest balance to the minimum, the residual difference is recorded
+	MinimumSearchStrategyClosestMatch MinimumSearchStrategy = "closest_match"
+)
+
 type DelegationStateCreationInfo struct {
 	Level         int64            `json:"level"`
 	Operation     tezos.OpHash     `json:"operation"`
 	Index         int              `json:"transaction_index"`
 	InternalIndex int              `json:"internal_result_index"`
 	Kind          CreationInfoKind `json:"kind"`
+
+	Strategy MinimumSearchStrategy `json:"strategy"`
+	// delegated balance minus the minimum reported by the protocol
+	Residual Mutez `json:"residual"`
 }
 
 type DelegationState struct {
@@ -139,10 +178,29 @@ func NewDelegationState(delegate *rpc.Delegate, cycle int64, lastBlockLevel rpc.
 	}
 }
 
+// copy with its own balances, used to replay balance updates in different ways
+func (d *DelegationState) Clone() *DelegationState {
+	d.balancesMtx.RLock()
+	defer d.balancesMtx.RUnlock()
+
+	result := &DelegationState{
+		Baker:          d.Baker,
+		Cycle:          d.Cycle,
+		LastBlockLevel: d.LastBlockLevel,
+		Parameters:     d.Parameters,
+		CreatedAt:      d.CreatedAt,
+		balances:       make(DelegationStateBalances, len(d.balances)),
+	}
+	for addr, balanceInfo := range d.balances {
+		result.balances[addr] = balanceInfo
+	}
+	return result
+}
+
 func (d *DelegationState) overstakeFactor() tezos.Z {
-	bakerStakingBalance := d.GetBakerStakedBalance()
-	limit := tezos.NewZ(d.Parameters.LimitOfStakingOverBakingMillionth).Mul64(bakerStakingBalance).Div64(1_000_000)
-	stakedBalance := tezos.NewZ(d.GetStakersStakedBalance())
+	bakerStakingBalance := d.GetBakerStakedBalance().Z()
+	limit := tezos.NewZ(d.Parameters.LimitOfStakingOverBakingMillionth).Mul(bakerStakingBalance).Div64(1_000_000)
+	stakedBalance := d.GetStakersStakedBalance().Z()
 	if stakedBalance.IsLess(limit) {
 		return tezos.Zero
 	}
@@ -166,11 +224,11 @@ func (d *DelegationState) UpdateBalance(address tezos.Address, kind string, chan
 	}
 	switch kind {
 	case "unfrozen_deposits":
-		balanceInfo.UnstakedBalance += change
+		balanceInfo.UnstakedBalance = balanceInfo.UnstakedBalance.Add64(change)
 	case "frozen_deposits":
-		balanceInfo.StakedBalance += change
+		balanceInfo.StakedBalance = balanceInfo.StakedBalance.Add64(change)
 	default:
-		balanceInfo.Balance += change
+		balanceInfo.Balance = balanceInfo.Balance.Add64(change)
 	}
 
 	d.balancesMtx.Lock()
@@ -212,10 +270,10 @@ func (d *DelegationState) GetDelegatorBalanceInfos() DelegationStateBalances {
 	return result
 }
 
-func (d *DelegationState) GetDelegatedBalance() int64 {
-	return lo.Reduce(lo.Values(d.GetDelegatorAndBakerBalances()), func(acc int64, balance DelegatorBalances, _ int) int64 {
-		return acc + balance.DelegatedBalance
-	}, 0)
+func (d *DelegationState) GetDelegatedBalance() Mutez {
+	return lo.Reduce(lo.Values(d.GetDelegatorAndBakerBalances()), func(acc Mutez, balance DelegatorBalances, _ int) Mutez {
+		return acc.Add(balance.DelegatedBalance)
+	}, Mutez{})
 }
 
 // includes baker own balance contributing to the total delegated balance
@@ -227,28 +285,28 @@ func (d *DelegationState) GetDelegatorAndBakerBalances() DelegatedBalances {
 
 	delegators := make(DelegatedBalances, len(d.balances))
 	for addr, balanceInfo := range d.balances {
-		delegatorBalances := DelegatorBalances{}
-		var overstakedBalance int64
+		delegatorBalances := DelegatorBalances{AccountType: GetAccountType(addr)}
+		var overstakedBalance Mutez
 
 		// unstaked balance is always for the baker we are checking
 		delegatorBalances.DelegatedBalance = balanceInfo.UnstakedBalance
 		if balanceInfo.Baker.Equal(d.Baker) {
 			/* unstaked balance comes from block with minimum which corresponds with d.Baker, not from the actual stake so we include it here */
-			delegatorBalances.DelegatedBalance += balanceInfo.Balance
+			delegatorBalances.DelegatedBalance = delegatorBalances.DelegatedBalance.Add(balanceInfo.Balance)
 		}
 
 		if balanceInfo.StakeBaker.Equal(d.Baker) {
 			delegatorBalances.StakedBalance = balanceInfo.StakedBalance
 			if addr.Equal(d.Baker) { // baker balance is never overstaked
-				overstakedBalance = 0
+				overstakedBalance = Mutez{}
 			} else {
-				overstakedBalance = overstakeFactor.Mul64(balanceInfo.StakedBalance).Div64(OVERSTAKE_PRECISION).Int64()
+				overstakedBalance = NewMutezFromZ(overstakeFactor.Mul(balanceInfo.StakedBalance.Z()).Div64(OVERSTAKE_PRECISION))
 			}
 
 			delegatorBalances.OverstakedBalance = overstakedBalance
 		}
 
-		if delegatorBalances.DelegatedBalance+delegatorBalances.StakedBalance == 0 {
+		if delegatorBalances.DelegatedBalance.Add(delegatorBalances.StakedBalance).IsZero() {
 			continue // skip empty balances
 		}
 
@@ -264,7 +322,7 @@ func (d *DelegationState) HasContractBalanceInfo(address tezos.Address) bool {
 	return ok
 }
 
-func (d *DelegationState) GetBakerStakedBalance() int64 {
+func (d *DelegationState) GetBakerStakedBalance() Mutez {
 	d.balancesMtx.RLock()
 	defer d.balancesMtx.RUnlock()
 
@@ -272,11 +330,11 @@ func (d *DelegationState) GetBakerStakedBalance() int64 {
 	return balanceInfo.StakedBalance
 }
 
-func (d *DelegationState) GetStakersStakedBalance() int64 {
+func (d *DelegationState) GetStakersStakedBalance() Mutez {
 	d.balancesMtx.RLock()
 	defer d.balancesMtx.RUnlock()
 
-	var stakedBalance int64
+	var stakedBalance Mutez
 	for addr, balanceInfo := range d.balances {
 		if addr.Equal(d.Baker) {
 			continue
@@ -284,22 +342,26 @@ func (d *DelegationState) GetStakersStakedBalance() int64 {
 		if !balanceInfo.StakeBaker.Equal(d.Baker) {
 			continue
 		}
-		stakedBalance += balanceInfo.StakedBalance
+		stakedBalance = stakedBalance.Add(balanceInfo.StakedBalance)
 	}
 	return stakedBalance
 }
 
-func (d *DelegationState) GetBakingPower() int64 {
-	balances := d.GetDelegatorAndBakerBalances()
-	stakedPower := lo.Reduce(lo.Values(balances), func(acc int64, balance DelegatorBalances, _ int) int64 {
-		return acc + balance.StakedBalance
-	}, 0)
-	delegatedPower := lo.Reduce(lo.Values(balances), func(acc int64, balance DelegatorBalances, _ int) int64 {
-		return acc + balance.DelegatedBalance
-	}, 0)
-
-	if d.Cycle < 748 {
-		return stakedPower + delegatedPower
+func (d *DelegationState) GetBakingPower() Mutez {
+	return GetBakingPower(d.Cycle, d.GetDelegatorAndBakerBalances())
+}
+
+// computes baking power from delegator balances, cycle is the cycle the balances were taken from
+func GetBakingPower(cycle int64, balances DelegatedBalances) Mutez {
+	stakedPower := lo.Reduce(lo.Values(balances), func(acc Mutez, balance DelegatorBalances, _ int) Mutez {
+		return acc.Add(balance.StakedBalance)
+	}, Mutez{})
+	delegatedPower := lo.Reduce(lo.Values(balances), func(acc Mutez, balance DelegatorBalances, _ int) Mutez {
+		return acc.Add(balance.DelegatedBalance)
+	}, Mutez{})
+
+	if cycle < 748 {
+		return stakedPower.Add(delegatedPower)
 	}
-	return stakedPower + delegatedPower/2
+	return stakedPower.Add(delegatedPower.Div64(2))
 }
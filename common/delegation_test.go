@@ -22,9 +22,9 @@ func TestOverstake(t *testing.T) {
 	}
 
 	s.AddBalance(tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx"), DelegationStateBalanceInfo{
-		Balance:         1000000000,
-		StakedBalance:   1000,
-		UnstakedBalance: 0,
+		Balance:         NewMutez(1000000000),
+		StakedBalance:   NewMutez(1000),
+		UnstakedBalance: NewMutez(0),
 		Baker:           baker,
 		StakeBaker:      baker,
 	})
@@ -32,9 +32,9 @@ func TestOverstake(t *testing.T) {
 	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
 
 	s.AddBalance(delegator, DelegationStateBalanceInfo{
-		Balance:         1000000000,
-		StakedBalance:   1000,
-		UnstakedBalance: 0,
+		Balance:         NewMutez(1000000000),
+		StakedBalance:   NewMutez(1000),
+		UnstakedBalance: NewMutez(0),
 		Baker:           baker,
 		StakeBaker:      baker,
 	})
@@ -52,23 +52,44 @@ func TestOverstake(t *testing.T) {
 	}
 
 	assert.Equal(int64(500000), s.overstakeFactor().Int64())
-	assert.Equal(int64(500), s.GetDelegatorAndBakerBalances()[delegator].OverstakedBalance)
+	assert.Equal(int64(500), s.GetDelegatorAndBakerBalances()[delegator].OverstakedBalance.Int64())
 
 	delegator2 := tezos.MustParseAddress("tz1S5WxdZR5f9NzsPXhr7L9L1vrEb5spZFur")
 
 	s.AddBalance(delegator2, DelegationStateBalanceInfo{
-		Balance:         1000000000,
-		StakedBalance:   1000,
-		UnstakedBalance: 0,
+		Balance:         NewMutez(1000000000),
+		StakedBalance:   NewMutez(1000),
+		UnstakedBalance: NewMutez(0),
 		Baker:           baker,
 		StakeBaker:      baker,
 	})
 
 	assert.Equal(int64(750000), s.overstakeFactor().Int64())
-	assert.Equal(int64(750), s.GetDelegatorAndBakerBalances()[delegator].OverstakedBalance)
-	assert.Equal(int64(750), s.GetDelegatorAndBakerBalances()[delegator2].OverstakedBalance)
-	assert.Equal(int64(1000000000), s.GetDelegatorAndBakerBalances()[delegator].DelegatedBalance)
-	assert.Equal(int64(1000000000), s.GetDelegatorAndBakerBalances()[delegator2].DelegatedBalance)
-	assert.Equal(int64(1000), s.GetDelegatorAndBakerBalances()[delegator].StakedBalance)
-	assert.Equal(int64(1000), s.GetDelegatorAndBakerBalances()[delegator2].StakedBalance)
+	assert.Equal(int64(750), s.GetDelegatorAndBakerBalances()[delegator].OverstakedBalance.Int64())
+	assert.Equal(int64(750), s.GetDelegatorAndBakerBalances()[delegator2].OverstakedBalance.Int64())
+	assert.Equal(int64(1000000000), s.GetDelegatorAndBakerBalances()[delegator].DelegatedBalance.Int64())
+	assert.Equal(int64(1000000000), s.GetDelegatorAndBakerBalances()[delegator2].DelegatedBalance.Int64())
+	assert.Equal(int64(1000), s.GetDelegatorAndBakerBalances()[delegator].StakedBalance.Int64())
+	assert.Equal(int64(1000), s.GetDelegatorAndBakerBalances()[delegator2].StakedBalance.Int64())
+}
+
+func TestDelegatorAccountTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	implicit := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	contract := tezos.MustParseAddress("KT1PHubm9HtyQEJ4BBpMTVomq6mhbfNZ9z5w")
+
+	s := NewDelegationState(&rpc.Delegate{Delegate: baker}, 749, rpc.BlockLevel(5898240))
+	s.Parameters = &StakingParameters{}
+	s.AddBalance(baker, DelegationStateBalanceInfo{Balance: NewMutez(1000), Baker: baker, StakeBaker: baker})
+	s.AddBalance(implicit, DelegationStateBalanceInfo{Balance: NewMutez(100), Baker: baker, StakeBaker: baker})
+	s.AddBalance(contract, DelegationStateBalanceInfo{Balance: NewMutez(10), Baker: baker})
+
+	balances := s.GetDelegatorAndBakerBalances()
+	assert.Equal(AccountTypeImplicit, balances[baker].AccountType)
+	assert.Equal(AccountTypeImplicit, balances[implicit].AccountType)
+	assert.Equal(AccountTypeOriginated, balances[contract].AccountType)
+	assert.Equal(NewMutez(10), balances[contract].DelegatedBalance)
+	assert.Equal(AccountType(""), GetAccountType(tezos.NewAddress(tezos.AddressTypeSmartRollup, make([]byte, 20))))
 }
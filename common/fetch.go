@@ -0,0 +1,99 @@
+package common
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type DelegateFetchStatus string
+
+const (
+	DelegateFetchStatusPending   DelegateFetchStatus = "pending"
+	DelegateFetchStatusSucceeded DelegateFetchStatus = "succeeded"
+	DelegateFetchStatusFailed    DelegateFetchStatus = "failed"
+)
+
+type StoredDelegateFetch struct {
+	Cycle       int64               `json:"cycle" gorm:"primaryKey"`
+	Delegate    Address             `json:"delegate" gorm:"primaryKey"`
+	Status      DelegateFetchStatus `json:"status" gorm:"index"`
+	Error       string              `json:"error,omitempty"`
+	Attempts    int                 `json:"attempts"`
+	NextRetryAt *time.Time          `json:"next_retry_at,omitempty"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+type CycleFetchStatus struct {
+	Cycle          int64                 `json:"cycle"`
+	LastBlockLevel int64                 `json:"last_block_level"`
+	Finished       bool                  `json:"finished"`
+	Complete       bool                  `json:"complete"`
+	Expected       int                   `json:"expected"`
+	Succeeded      int                   `json:"succeeded"`
+	Failed         int                   `json:"failed"`
+	Pending        int                   `json:"pending"`
+	StartedAt      time.Time             `json:"started_at"`
+	FinishedAt     *time.Time            `json:"finished_at,omitempty"`
+	Failures       []StoredDelegateFetch `json:"failures"`
+}
+
+type FetchAuditOptions struct {
+	Force bool `json:"force"`
+	Debug bool `json:"debug"`
+}
+
+func (j FetchAuditOptions) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *FetchAuditOptions) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+type FetchAuditProviders []string
+
+func (j FetchAuditProviders) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *FetchAuditProviders) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+// append-only record of a delegate fetch, rows are never updated nor pruned
+type StoredFetchAudit struct {
+	ID       int64             `json:"id" gorm:"primaryKey;autoIncrement"`
+	Delegate Address           `json:"delegate" gorm:"index:idx_fetch_audit_delegate_cycle"`
+	Cycle    int64             `json:"cycle" gorm:"index:idx_fetch_audit_delegate_cycle"`
+	Options  FetchAuditOptions `json:"options" gorm:"type:jsonb;default:'{}'"`
+	// rpc and tzkt urls which served the requests of the fetch
+	Providers  FetchAuditProviders `json:"providers" gorm:"type:jsonb;default:'[]'"`
+	StartedAt  time.Time           `json:"started_at"`
+	DurationMs int64               `json:"duration_ms"`
+	// resulting state, missing if the fetch failed before a state was computed
+	Status         *DelegationStateStatus      `json:"status,omitempty"`
+	ContractsCount int                         `json:"contracts_count"`
+	CreatedAt      DelegationStateCreationInfo `json:"created_at" gorm:"type:jsonb;default:'{}'"`
+	BalancesHash   string                      `json:"balances_hash,omitempty"`
+	// version the state was stored as, see StoredDelegationStateVersion
+	Version int64  `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
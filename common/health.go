@@ -0,0 +1,34 @@
+package common
+
+import "time"
+
+type SchedulerMode string
+
+const (
+	SchedulerModeMonitor SchedulerMode = "monitor"
+	SchedulerModePolling SchedulerMode = "polling"
+)
+
+type SchedulerStatus struct {
+	Mode          SchedulerMode `json:"mode"`
+	LastHeadLevel int64         `json:"last_head_level"`
+	LastHeadAt    *time.Time    `json:"last_head_at,omitempty"`
+	// fetch of the next cycle is triggered once its last block has enough confirmations
+	NextCycle           int64      `json:"next_cycle"`
+	NextCycleEndLevel   int64      `json:"next_cycle_end_level"`
+	NextTriggerLevel    int64      `json:"next_trigger_level"`
+	LastTriggerAt       *time.Time `json:"last_trigger_at,omitempty"`
+	LastTriggerCycle    int64      `json:"last_trigger_cycle"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+type EngineHealth struct {
+	Status           string `json:"status"`
+	ShuttingDown     bool   `json:"shutting_down"`
+	RunningFetches   int    `json:"running_fetches"`
+	LastFetchedCycle int64  `json:"last_fetched_cycle"`
+	Offline          bool   `json:"offline"`
+
+	Scheduler *SchedulerStatus `json:"scheduler,omitempty"`
+}
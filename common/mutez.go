@@ -0,0 +1,185 @@
+package common
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/trilitech/tzgo/tezos"
+)
+
+// Mutez is an arbitrary precision amount, serialized as a decimal string.
+// Decoding accepts both strings and numbers so states stored with int64 balances remain readable.
+type Mutez tezos.Z
+
+// zero is always kept in its zero value representation so states can be compared structurally
+func normalizeMutez(z tezos.Z) Mutez {
+	if z.IsZero() {
+		return Mutez{}
+	}
+	return Mutez(z)
+}
+
+func NewMutez(amount int64) Mutez {
+	return normalizeMutez(tezos.NewZ(amount))
+}
+
+func NewMutezFromZ(amount tezos.Z) Mutez {
+	return normalizeMutez(amount.Clone())
+}
+
+func ParseMutez(amount string) (Mutez, error) {
+	z, err := tezos.ParseZ(amount)
+	if err != nil {
+		return Mutez{}, err
+	}
+	return normalizeMutez(z), nil
+}
+
+func MustParseMutez(amount string) Mutez {
+	result, err := ParseMutez(amount)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func SumMutez(amounts ...Mutez) Mutez {
+	total := Mutez{}
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+func (m Mutez) Z() tezos.Z {
+	return tezos.Z(m)
+}
+
+func (m Mutez) Big() *big.Int {
+	return m.Z().Big()
+}
+
+func (m Mutez) Add(other Mutez) Mutez {
+	return normalizeMutez(m.Z().Add(other.Z()))
+}
+
+func (m Mutez) Add64(other int64) Mutez {
+	return normalizeMutez(m.Z().Add64(other))
+}
+
+func (m Mutez) Sub(other Mutez) Mutez {
+	return normalizeMutez(m.Z().Sub(other.Z()))
+}
+
+func (m Mutez) Sub64(other int64) Mutez {
+	return normalizeMutez(m.Z().Sub64(other))
+}
+
+func (m Mutez) Mul64(other int64) Mutez {
+	return normalizeMutez(m.Z().Mul64(other))
+}
+
+// truncates towards zero like integer division, division by zero results in zero
+func (m Mutez) Div64(other int64) Mutez {
+	if other == 0 {
+		return Mutez{}
+	}
+	return normalizeMutez(tezos.NewBigZ(new(big.Int).Quo(m.Big(), big.NewInt(other))))
+}
+
+func (m Mutez) Neg() Mutez {
+	return normalizeMutez(m.Z().Neg())
+}
+
+func (m Mutez) Abs() Mutez {
+	if m.IsNeg() {
+		return m.Neg()
+	}
+	return m
+}
+
+func (m Mutez) Cmp(other Mutez) int {
+	return m.Z().Cmp(other.Z())
+}
+
+func (m Mutez) Equal(other Mutez) bool {
+	return m.Cmp(other) == 0
+}
+
+func (m Mutez) IsLess(other Mutez) bool {
+	return m.Cmp(other) < 0
+}
+
+func (m Mutez) IsZero() bool {
+	return m.Z().IsZero()
+}
+
+func (m Mutez) IsNeg() bool {
+	return m.Z().IsNeg()
+}
+
+// truncates values which do not fit into int64, use only where the range is known
+func (m Mutez) Int64() int64 {
+	return m.Z().Int64()
+}
+
+func (m Mutez) String() string {
+	return m.Z().String()
+}
+
+func (m Mutez) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+func (m *Mutez) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*m = Mutez{}
+		return nil
+	}
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 {
+		return errors.New("empty amount")
+	}
+	result, err := ParseMutez(string(data))
+	if err != nil {
+		return err
+	}
+	*m = result
+	return nil
+}
+
+// stored as numeric column
+func (m Mutez) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Mutez) Scan(src interface{}) error {
+	switch source := src.(type) {
+	case nil:
+		*m = Mutez{}
+		return nil
+	case int64:
+		*m = NewMutez(source)
+		return nil
+	case []byte:
+		return m.UnmarshalJSON(source)
+	case string:
+		return m.UnmarshalJSON([]byte(source))
+	default:
+		return fmt.Errorf("unsupported amount type %T", src)
+	}
+}
+
+// MutezNumber is always serialized as a json number, used by the tzkt compatible responses
+type MutezNumber Mutez
+
+func (m MutezNumber) MarshalJSON() ([]byte, error) {
+	return []byte(Mutez(m).String()), nil
+}
+
+func (m *MutezNumber) UnmarshalJSON(data []byte) error {
+	return (*Mutez)(m).UnmarshalJSON(data)
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutezJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	// beyond int64 range
+	huge := MustParseMutez("92233720368547758070")
+	data, err := json.Marshal(DelegatorBalances{DelegatedBalance: huge, StakedBalance: NewMutez(-5)})
+	assert.Nil(err)
+	assert.Equal(`{"delegated_balance":"92233720368547758070","overstaked_balance":"0","staked_balance":"-5"}`, string(data))
+
+	var decoded DelegatorBalances
+	assert.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal(DelegatorBalances{DelegatedBalance: huge, StakedBalance: NewMutez(-5)}, decoded)
+
+	// legacy numeric format
+	var legacy DelegatorBalances
+	assert.Nil(json.Unmarshal([]byte(`{"delegated_balance":1000,"overstaked_balance":0,"staked_balance":92233720368547758070}`), &legacy))
+	assert.Equal(DelegatorBalances{DelegatedBalance: NewMutez(1000), StakedBalance: huge}, legacy)
+
+	data, err = MarshalNumericAmountsJSON(DelegatorBalances{DelegatedBalance: huge})
+	assert.Nil(err)
+	assert.Equal(`{"delegated_balance":92233720368547758070,"overstaked_balance":0,"staked_balance":0}`, string(data))
+
+	// numeric amounts do not leak into the canonical encoding
+	data, err = json.Marshal(DelegatorBalances{DelegatedBalance: huge})
+	assert.Nil(err)
+	assert.Equal(`{"delegated_balance":"92233720368547758070","overstaked_balance":"0","staked_balance":"0"}`, string(data))
+}
+
+func TestMutezArithmetic(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Mutez{}, NewMutez(5).Sub(NewMutez(5)))
+	assert.Equal(NewMutez(-3), NewMutez(-7).Div64(2))
+	assert.Equal(NewMutez(7), NewMutez(-7).Abs())
+	assert.Equal(MustParseMutez("18446744073709551614"), SumMutez(NewMutez(9223372036854775807), NewMutez(9223372036854775807)))
+}
@@ -0,0 +1,197 @@
+package common
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	mutezType         = reflect.TypeOf(Mutez{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// serializes amounts as json numbers, for api consumers relying on the legacy format.
+// Only api responses are encoded this way, stored and signed data always use strings.
+func MarshalNumericAmountsJSON(v any) ([]byte, error) {
+	value, err := numericAmounts(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+type objectField struct {
+	name  string
+	value any
+}
+
+// keeps fields in the order of the struct like encoding/json does
+type orderedObject []objectField
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		builder.Write(name)
+		builder.WriteByte(':')
+		builder.Write(value)
+	}
+	builder.WriteByte('}')
+	return []byte(builder.String()), nil
+}
+
+// mirrors the value with Mutez replaced by json numbers, values with their own encoding are kept as they are
+func numericAmounts(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type() == mutezType {
+		return json.Number(v.Interface().(Mutez).String()), nil
+	}
+	if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface && hasOwnEncoding(v.Type()) {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.Kind() == reflect.Pointer && hasOwnEncoding(v.Type()) && !hasOwnEncoding(v.Type().Elem()) && v.Type().Elem() != mutezType {
+			// marshaler with pointer receiver
+			return v.Interface(), nil
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		return numericAmounts(v.Elem())
+	case reflect.Struct:
+		object := orderedObject{}
+		if err := appendStructFields(&object, v); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		result := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if result[key], err = numericAmounts(iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return v.Interface(), nil
+		}
+		result := make([]any, v.Len())
+		for i := range result {
+			var err error
+			if result[i], err = numericAmounts(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	return v.Interface(), nil
+}
+
+func hasOwnEncoding(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType)
+}
+
+// exported fields by their json tags, fields of embedded structs are promoted
+func appendStructFields(object *orderedObject, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		value := v.Field(i)
+
+		if field.Anonymous && name == "" {
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				if err := appendStructFields(object, value); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(options, "omitempty") && isEmptyValue(value) {
+			continue
+		}
+
+		encoded, err := numericAmounts(value)
+		if err != nil {
+			return err
+		}
+		*object = append(*object, objectField{name: name, value: encoded})
+	}
+	return nil
+}
+
+func mapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if marshaler, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %s", key.Type())
+}
+
+// same as encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
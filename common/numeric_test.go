@@ -0,0 +1,100 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestMarshalNumericAmountsJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	type embedded struct {
+		Level string `json:"level"`
+	}
+	type response struct {
+		embedded
+		Id       string            `json:"id"`
+		Amount   Mutez             `json:"amount"`
+		Optional *Mutez            `json:"optional,omitempty"`
+		Amounts  map[int64]Mutez   `json:"amounts"`
+		Legacy   MutezNumber       `json:"legacy"`
+		Note     string            `json:"note,omitempty"`
+		Ignored  string            `json:"-"`
+		Values   []any             `json:"values"`
+		Balances DelegatedBalances `json:"balances"`
+	}
+
+	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	amount := MustParseMutez("92233720368547758070")
+	data, err := MarshalNumericAmountsJSON(response{
+		embedded: embedded{Level: "5799936"},
+		Id:       "745",
+		Amount:   NewMutez(-5),
+		Optional: &amount,
+		Amounts:  map[int64]Mutez{745: NewMutez(10)},
+		Legacy:   MutezNumber(NewMutez(7)),
+		Ignored:  "1",
+		Values:   []any{"12", NewMutez(12), nil},
+		Balances: DelegatedBalances{delegator: {DelegatedBalance: NewMutez(100)}},
+	})
+	assert.Nil(err)
+	// digit strings which are not amounts stay quoted
+	assert.Equal(`{"level":"5799936","id":"745","amount":-5,"optional":92233720368547758070,"amounts":{"745":10},"legacy":7,"values":["12",12,null],"balances":{"tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM":{"delegated_balance":100,"overstaked_balance":0,"staked_balance":0}}}`, string(data))
+}
+
+// apart from amounts the encoding matches encoding/json
+func TestMarshalNumericAmountsJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	state := StoredDelegationState{
+		Delegate:      Address{Address: baker},
+		Cycle:         745,
+		Status:        DelegationStateStatusOk,
+		Balances:      DelegatedBalances{baker: {StakedBalance: NewMutez(1000)}},
+		LastBlockHash: "BLockHash",
+		CreatedAt:     DelegationStateCreationInfo{Level: 5799936},
+	}
+	preview := DelegationStatePreview{Provisional: true, Cycle: 746, ComputedAt: time.Now().UTC(), BakingPower: NewMutez(1000)}
+
+	for _, value := range []any{state, &preview, []StoredDelegationState{state}} {
+		canonical, err := json.Marshal(value)
+		assert.Nil(err)
+		numeric, err := MarshalNumericAmountsJSON(value)
+		assert.Nil(err)
+
+		assert.Equal(decodeAmountsAsNumbers(t, canonical), decodeAmountsAsNumbers(t, numeric))
+	}
+}
+
+// amounts compared regardless of their encoding
+func decodeAmountsAsNumbers(t *testing.T, data []byte) any {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result any
+	assert.Nil(t, decoder.Decode(&result))
+	return normalizeAmounts(result)
+}
+
+func normalizeAmounts(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = normalizeAmounts(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = normalizeAmounts(item)
+		}
+	case string:
+		if _, err := ParseMutez(value); err == nil {
+			return json.Number(value)
+		}
+	}
+	return v
+}
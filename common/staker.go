@@ -0,0 +1,89 @@
+package common
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/trilitech/tzgo/tezos"
+)
+
+// unstake request held by a single baker, the cycle is the one the unstake was requested in
+type StakerUnstakeRequest struct {
+	Cycle       int64 `json:"cycle"`
+	Amount      Mutez `json:"amount"`
+	Finalizable bool  `json:"finalizable"`
+}
+
+// stake and unstake requests of a staker with a baker at the end of a cycle
+type StakerLedgerEntry struct {
+	Staker        tezos.Address          `json:"staker"`
+	Baker         tezos.Address          `json:"baker"`
+	Cycle         int64                  `json:"cycle"`
+	StakedBalance Mutez                  `json:"staked_balance"`
+	Requests      []StakerUnstakeRequest `json:"requests"`
+}
+
+func (u *UnstakeRequests) GetRequestsForBaker(baker tezos.Address) []StakerUnstakeRequest {
+	result := make([]StakerUnstakeRequest, 0)
+	for _, request := range u.Finalizable {
+		if request.Delegate.Equal(baker) {
+			result = append(result, StakerUnstakeRequest{Cycle: request.Cycle, Amount: NewMutezFromZ(request.Amount), Finalizable: true})
+		}
+	}
+	if u.Unfinalizable.Delegate.Equal(baker) {
+		for _, request := range u.Unfinalizable.Requests {
+			result = append(result, StakerUnstakeRequest{Cycle: request.Cycle, Amount: NewMutezFromZ(request.Amount)})
+		}
+	}
+	return result
+}
+
+// contracts staking with the baker at the end of the cycle or with unstaked deposits held by the baker at the minimum,
+// stakers which unstaked everything after the minimum are picked up in the next cycle
+func (d *DelegationState) GetStakers() []tezos.Address {
+	d.balancesMtx.RLock()
+	defer d.balancesMtx.RUnlock()
+
+	result := make([]tezos.Address, 0)
+	for addr, balanceInfo := range d.balances {
+		staking := balanceInfo.StakeBaker.Equal(d.Baker) && !balanceInfo.StakedBalance.IsZero()
+		if staking || !balanceInfo.UnstakedBalance.IsZero() {
+			result = append(result, addr)
+		}
+	}
+	slices.SortFunc(result, func(a, b tezos.Address) int { return strings.Compare(a.String(), b.String()) })
+	return result
+}
+
+// stake and unstaked funds of a staker held by a baker at the end of a cycle
+type StoredStakerBalance struct {
+	Staker        Address `json:"staker" gorm:"primaryKey"`
+	Baker         Address `json:"baker" gorm:"primaryKey"`
+	Cycle         int64   `json:"cycle" gorm:"primaryKey"`
+	StakedBalance Mutez   `json:"staked_balance" gorm:"type:numeric;default:0"`
+	// unstaked and ready to be finalized by the staker
+	FinalizableBalance Mutez `json:"finalizable_balance" gorm:"type:numeric;default:0"`
+	// unstaked but still frozen
+	PendingBalance Mutez `json:"pending_balance" gorm:"type:numeric;default:0"`
+	// finalized since the previous cycle
+	FinalizedBalance Mutez `json:"finalized_balance" gorm:"type:numeric;default:0"`
+}
+
+// lifecycle of an unstake request, cycle is the one the unstake was requested in
+type StoredUnstakeRequest struct {
+	Staker           Address `json:"staker" gorm:"primaryKey"`
+	Baker            Address `json:"baker" gorm:"primaryKey"`
+	Cycle            int64   `json:"cycle" gorm:"primaryKey"`
+	Amount           Mutez   `json:"amount" gorm:"type:numeric;default:0"`
+	FirstSeenCycle   int64   `json:"first_seen_cycle"`
+	LastSeenCycle    int64   `json:"last_seen_cycle"`
+	FinalizableCycle *int64  `json:"finalizable_cycle,omitempty"`
+	// first cycle the request was not reported anymore
+	FinalizedCycle *int64 `json:"finalized_cycle,omitempty" gorm:"index"`
+}
+
+type StakerLedger struct {
+	Staker          tezos.Address          `json:"staker"`
+	Balances        []StoredStakerBalance  `json:"balances"`
+	UnstakeRequests []StoredUnstakeRequest `json:"unstake_requests"`
+}
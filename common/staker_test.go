@@ -0,0 +1,29 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestGetRequestsForBaker(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	var requests UnstakeRequests
+	assert.Nil(json.Unmarshal([]byte(`{
+		"finalizable": [
+			{"delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx", "amount": "100", "cycle": 745},
+			{"delegate": "tz1S5WxdZR5f9NzsPXhr7L9L1vrEb5spZFur", "amount": "200", "cycle": 745}
+		],
+		"unfinalizable": {"delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx", "requests": [{"amount": "50", "cycle": 749}]}
+	}`), &requests))
+
+	assert.Equal([]StakerUnstakeRequest{
+		{Cycle: 745, Amount: NewMutez(100), Finalizable: true},
+		{Cycle: 749, Amount: NewMutez(50)},
+	}, requests.GetRequestsForBaker(baker))
+	assert.Equal(requests.GetUnstakedTotalForBaker(baker), SumMutez(NewMutez(100), NewMutez(50)))
+}
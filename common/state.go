@@ -0,0 +1,489 @@
+package common
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type DelegationStateStatus int
+
+const (
+	DelegationStateStatusOk                  DelegationStateStatus = iota
+	DelegationStateStatusMinimumNotAvailable                       // 1
+	DelegationStateStatusMinimumApproximated                       // 2, found by the closest match, see MinimumResidual
+	DelegationStateStatusDeactivated                               // 3, delegate was deactivated by the end of the cycle
+	DelegationStateStatusNotRegistered                             // 4, address is not a registered delegate
+	DelegationStateStatusZeroBalance                               // 5, delegate has neither delegated nor staked balance
+	DelegationStateStatusPartial                                   // 6, balances of some contracts could not be fetched, see StatusReason
+)
+
+type DelegationStateQueryStatus string
+
+const (
+	DelegationStateQueryStatusOk                  DelegationStateQueryStatus = "ok"
+	DelegationStateQueryStatusNotFound            DelegationStateQueryStatus = "not_found"
+	DelegationStateQueryStatusMinimumNotAvailable DelegationStateQueryStatus = "minimum_not_available"
+	DelegationStateQueryStatusMinimumApproximated DelegationStateQueryStatus = "minimum_approximated"
+	DelegationStateQueryStatusDeactivated         DelegationStateQueryStatus = "deactivated"
+	DelegationStateQueryStatusNotRegistered       DelegationStateQueryStatus = "not_registered"
+	DelegationStateQueryStatusZeroBalance         DelegationStateQueryStatus = "zero_balance"
+	DelegationStateQueryStatusPartial             DelegationStateQueryStatus = "partial"
+)
+
+func (s DelegationStateStatus) QueryStatus() DelegationStateQueryStatus {
+	switch s {
+	case DelegationStateStatusMinimumNotAvailable:
+		return DelegationStateQueryStatusMinimumNotAvailable
+	case DelegationStateStatusMinimumApproximated:
+		return DelegationStateQueryStatusMinimumApproximated
+	case DelegationStateStatusDeactivated:
+		return DelegationStateQueryStatusDeactivated
+	case DelegationStateStatusNotRegistered:
+		return DelegationStateQueryStatusNotRegistered
+	case DelegationStateStatusZeroBalance:
+		return DelegationStateQueryStatusZeroBalance
+	case DelegationStateStatusPartial:
+		return DelegationStateQueryStatusPartial
+	default:
+		return DelegationStateQueryStatusOk
+	}
+}
+
+func (j DelegatedBalances) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *DelegatedBalances) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+func (j StakingParameters) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *StakingParameters) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+func (j DelegationStateCreationInfo) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *DelegationStateCreationInfo) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+type Address struct {
+	tezos.Address
+}
+
+func (a Address) Value() (driver.Value, error) {
+	return a.Address.String(), nil
+}
+
+func (a *Address) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	addr, err := tezos.ParseAddress(string(source))
+	if err != nil {
+		return err
+	}
+	a.Address = addr
+	return nil
+}
+
+type TzktDelegator struct {
+	Address          tezos.Address `json:"address"`
+	DelegatedBalance MutezNumber   `json:"delegatedBalance"`
+	StakedBalance    MutezNumber   `json:"stakedBalance"`
+}
+
+type TzktLikeDelegationState struct {
+	Cycle                    int64           `json:"cycle"`
+	OwnDelegatedBalance      MutezNumber     `json:"ownDelegatedBalance"`
+	OwnStakedBalance         MutezNumber     `json:"ownStakedBalance"`
+	ExternalDelegatedBalance MutezNumber     `json:"externalDelegatedBalance"`
+	ExternalStakedBalance    MutezNumber     `json:"externalStakedBalance"`
+	DelegatorsCount          int             `json:"delegatorsCount"`
+	Delegators               []TzktDelegator `json:"delegators"`
+}
+
+type DelegationStateHistoryEntry struct {
+	// cycle the state is relevant for
+	Cycle int64 `json:"cycle"`
+	// cycle the state was taken from, see GetCycleBakingPowerOrigin
+	OriginCycle              int64                 `json:"origin_cycle"`
+	Status                   DelegationStateStatus `json:"status"`
+	OwnDelegatedBalance      Mutez                 `json:"own_delegated_balance"`
+	OwnStakedBalance         Mutez                 `json:"own_staked_balance"`
+	ExternalDelegatedBalance Mutez                 `json:"external_delegated_balance"`
+	ExternalStakedBalance    Mutez                 `json:"external_staked_balance"`
+	DelegatorsCount          int                   `json:"delegators_count"`
+	BakingPower              Mutez                 `json:"baking_power"`
+}
+
+type StoredDelegationState struct {
+	Delegate Address               `json:"delegate" gorm:"primaryKey"`
+	Cycle    int64                 `json:"cycle" gorm:"primaryKey"`
+	Status   DelegationStateStatus `json:"status"`
+	// why the state is not ok, e.g. contracts which failed to fetch
+	StatusReason string            `json:"status_reason,omitempty"`
+	Balances     DelegatedBalances `json:"balances" gorm:"type:jsonb;default:'{}'"`
+	// strategy which found the minimum delegated balance and the difference against the protocol reported minimum
+	MinimumSearchStrategy MinimumSearchStrategy `json:"minimum_search_strategy,omitempty"`
+	MinimumResidual       Mutez                 `json:"minimum_residual" gorm:"type:numeric;default:0"`
+	// inputs of the computation, kept so the state can be exported and verified on its own
+	StakingParameters StakingParameters           `json:"staking_parameters" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt         DelegationStateCreationInfo `json:"created_at" gorm:"type:jsonb;default:'{}'"`
+	// last block of the cycle the state was computed from, states on an orphaned branch are refetched
+	LastBlockLevel int64  `json:"last_block_level"`
+	LastBlockHash  string `json:"last_block_hash,omitempty" gorm:"index"`
+	// see StoredDelegationStateVersion
+	Version int64 `json:"version"`
+}
+
+type CycleRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type DelegationStatesQuery struct {
+	Delegates []tezos.Address `json:"delegates"`
+	// additional cycle ranges, both ends inclusive
+	Cycles []CycleRange `json:"cycles,omitempty"`
+}
+
+// result of a batch query, cycle is the requested cycle, the state itself carries the baking power origin cycle
+type DelegationStateQueryResult struct {
+	Delegate tezos.Address              `json:"delegate"`
+	Cycle    int64                      `json:"cycle"`
+	Status   DelegationStateQueryStatus `json:"status"`
+	State    *StoredDelegationState     `json:"state,omitempty"`
+}
+
+type UpcomingDelegatorWeight struct {
+	Address          tezos.Address `json:"address"`
+	DelegatedBalance Mutez         `json:"delegated_balance"`
+	StakedBalance    Mutez         `json:"staked_balance"`
+	// contribution to the baking power of the delegate
+	BakingPower Mutez `json:"baking_power"`
+	// share of the baking power of the delegate, the remainder belongs to the delegate itself
+	Weight float64 `json:"weight"`
+}
+
+// future cycle governed by an already stored state
+type UpcomingCycle struct {
+	Cycle int64 `json:"cycle"`
+	// cycle the state was taken from, see GetCycleBakingPowerOrigin
+	OriginCycle        int64                     `json:"origin_cycle"`
+	Status             DelegationStateStatus     `json:"status"`
+	BakingPower        Mutez                     `json:"baking_power"`
+	NetworkBakingPower Mutez                     `json:"network_baking_power"`
+	BakingPowerShare   float64                   `json:"baking_power_share"`
+	Delegators         []UpcomingDelegatorWeight `json:"delegators"`
+}
+
+// provisional state of the running cycle computed at the head, it is never stored
+type DelegationStatePreview struct {
+	Provisional bool  `json:"provisional"`
+	Cycle       int64 `json:"cycle"`
+	// head the preview was computed at
+	Level      int64     `json:"level"`
+	ComputedAt time.Time `json:"computed_at"`
+	// minimum so far, it may still drop before the cycle ends
+	MinDelegatedBalance Mutez                  `json:"min_delegated_balance"`
+	MinDelegatedLevel   int64                  `json:"min_delegated_level"`
+	BakingPower         Mutez                  `json:"baking_power"`
+	State               *StoredDelegationState `json:"state"`
+}
+
+func (s *StoredDelegationState) OwnDelegatedbalance() DelegatorBalances {
+	return s.Balances[s.Delegate.Address]
+}
+
+func (s *StoredDelegationState) ExternalDelegatedBalance() DelegatorBalances {
+	result := DelegatorBalances{}
+	for addr, balances := range s.Balances {
+		if !addr.Equal(s.Delegate.Address) {
+			result.DelegatedBalance = result.DelegatedBalance.Add(balances.DelegatedBalance)
+			result.OverstakedBalance = result.OverstakedBalance.Add(balances.OverstakedBalance)
+			result.StakedBalance = result.StakedBalance.Add(balances.StakedBalance)
+		}
+	}
+	return result
+}
+
+func (s *StoredDelegationState) DelegatorsCount() int {
+	count := 0
+	for addr := range s.Balances {
+		if !addr.Equal(s.Delegate.Address) && !addr.Equal(tezos.BurnAddress) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *StoredDelegationState) BakingPower() Mutez {
+	return GetBakingPower(s.Cycle, s.Balances)
+}
+
+func (s *StoredDelegationState) Statistics() DelegateCycleStatistics {
+	ownBalances := s.OwnDelegatedbalance()
+	externalBalances := s.ExternalDelegatedBalance()
+
+	return DelegateCycleStatistics{
+		OwnStaked:          ownBalances.StakedBalance,
+		OwnDelegated:       ownBalances.DelegatedBalance,
+		ExternalStaked:     externalBalances.StakedBalance,
+		ExternalDelegated:  externalBalances.DelegatedBalance,
+		ExternalOverstaked: externalBalances.OverstakedBalance,
+		DelegatorsCount:    s.DelegatorsCount(),
+		BakingPower:        s.BakingPower(),
+	}
+}
+
+func (s *StoredDelegationState) ToHistoryEntry(cycle int64) DelegationStateHistoryEntry {
+	ownBalances := s.OwnDelegatedbalance()
+	externalBalances := s.ExternalDelegatedBalance()
+
+	return DelegationStateHistoryEntry{
+		Cycle:                    cycle,
+		OriginCycle:              s.Cycle,
+		Status:                   s.Status,
+		OwnDelegatedBalance:      ownBalances.DelegatedBalance,
+		OwnStakedBalance:         ownBalances.StakedBalance,
+		ExternalDelegatedBalance: externalBalances.DelegatedBalance,
+		ExternalStakedBalance:    externalBalances.StakedBalance,
+		DelegatorsCount:          s.DelegatorsCount(),
+		BakingPower:              s.BakingPower(),
+	}
+}
+
+func ratio(a, b Mutez) float64 {
+	if b.IsZero() {
+		return 0
+	}
+	result, _ := new(big.Rat).SetFrac(a.Big(), b.Big()).Float64()
+	return result
+}
+
+// delegators are sorted by their contribution, largest first
+func (s *StoredDelegationState) ToUpcomingCycle(cycle int64, networkBakingPower Mutez) UpcomingCycle {
+	bakingPower := s.BakingPower()
+	delegators := make([]UpcomingDelegatorWeight, 0, len(s.Balances))
+	for addr, balances := range s.Balances {
+		if addr.Equal(s.Delegate.Address) || addr.Equal(tezos.BurnAddress) {
+			continue
+		}
+		contribution := GetBakingPower(s.Cycle, DelegatedBalances{addr: balances})
+		delegators = append(delegators, UpcomingDelegatorWeight{
+			Address:          addr,
+			DelegatedBalance: balances.DelegatedBalance,
+			StakedBalance:    balances.StakedBalance,
+			BakingPower:      contribution,
+			Weight:           ratio(contribution, bakingPower),
+		})
+	}
+	slices.SortFunc(delegators, func(a, b UpcomingDelegatorWeight) int {
+		if c := b.BakingPower.Cmp(a.BakingPower); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Address.String(), b.Address.String())
+	})
+
+	return UpcomingCycle{
+		Cycle:              cycle,
+		OriginCycle:        s.Cycle,
+		Status:             s.Status,
+		BakingPower:        bakingPower,
+		NetworkBakingPower: networkBakingPower,
+		BakingPowerShare:   ratio(bakingPower, networkBakingPower),
+		Delegators:         delegators,
+	}
+}
+
+func (s *StoredDelegationState) ToTzktState() *TzktLikeDelegationState {
+	delegators := make([]TzktDelegator, 0, len(s.Balances)-1)
+	for addr, balances := range s.Balances {
+		if !addr.Equal(s.Delegate.Address) && !addr.Equal(tezos.BurnAddress) {
+			delegators = append(delegators, TzktDelegator{
+				Address: addr,
+				// move overstaked balance to delegated balance
+				DelegatedBalance: MutezNumber(balances.DelegatedBalance.Add(balances.OverstakedBalance)),
+				StakedBalance:    MutezNumber(balances.StakedBalance.Sub(balances.OverstakedBalance)),
+			})
+		}
+	}
+
+	ownBalances := s.OwnDelegatedbalance()
+	externalBalances := s.ExternalDelegatedBalance()
+
+	result := &TzktLikeDelegationState{
+		Cycle:                    s.Cycle,
+		OwnDelegatedBalance:      MutezNumber(ownBalances.DelegatedBalance),
+		OwnStakedBalance:         MutezNumber(ownBalances.StakedBalance),
+		ExternalDelegatedBalance: MutezNumber(externalBalances.DelegatedBalance),
+		ExternalStakedBalance:    MutezNumber(externalBalances.StakedBalance),
+		DelegatorsCount:          len(delegators),
+		Delegators:               delegators,
+	}
+	return result
+}
+
+type DelegatorBalancesDelta struct {
+	Address           tezos.Address `json:"address"`
+	DelegatedBalance  Mutez         `json:"delegated_balance"`
+	StakedBalance     Mutez         `json:"staked_balance"`
+	OverstakedBalance Mutez         `json:"overstaked_balance"`
+}
+
+func (d DelegatorBalancesDelta) magnitude() Mutez {
+	return d.DelegatedBalance.Abs().Add(d.StakedBalance.Abs()).Add(d.OverstakedBalance.Abs())
+}
+
+func (d DelegatorBalancesDelta) isZero() bool {
+	return d.DelegatedBalance.IsZero() && d.StakedBalance.IsZero() && d.OverstakedBalance.IsZero()
+}
+
+type DelegationStateDiff struct {
+	Delegate tezos.Address            `json:"delegate"`
+	CycleA   int64                    `json:"cycle_a"`
+	CycleB   int64                    `json:"cycle_b"`
+	Added    []DelegatorBalancesDelta `json:"added"`
+	Removed  []DelegatorBalancesDelta `json:"removed"`
+	Changed  []DelegatorBalancesDelta `json:"changed"`
+}
+
+func sortDeltasByMagnitude(deltas []DelegatorBalancesDelta) {
+	slices.SortFunc(deltas, func(a, b DelegatorBalancesDelta) int {
+		if c := b.magnitude().Cmp(a.magnitude()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Address.String(), b.Address.String())
+	})
+}
+
+// compares delegators of two states of the same delegate, baker own balances are not included
+func DiffDelegationStates(a, b *StoredDelegationState) *DelegationStateDiff {
+	result := &DelegationStateDiff{
+		Delegate: a.Delegate.Address,
+		CycleA:   a.Cycle,
+		CycleB:   b.Cycle,
+		Added:    []DelegatorBalancesDelta{},
+		Removed:  []DelegatorBalancesDelta{},
+		Changed:  []DelegatorBalancesDelta{},
+	}
+
+	isDelegator := func(addr tezos.Address) bool {
+		return !addr.Equal(a.Delegate.Address) && !addr.Equal(tezos.BurnAddress)
+	}
+
+	for addr, balancesB := range b.Balances {
+		if !isDelegator(addr) {
+			continue
+		}
+		balancesA, ok := a.Balances[addr]
+		delta := DelegatorBalancesDelta{
+			Address:           addr,
+			DelegatedBalance:  balancesB.DelegatedBalance.Sub(balancesA.DelegatedBalance),
+			StakedBalance:     balancesB.StakedBalance.Sub(balancesA.StakedBalance),
+			OverstakedBalance: balancesB.OverstakedBalance.Sub(balancesA.OverstakedBalance),
+		}
+		switch {
+		case !ok:
+			result.Added = append(result.Added, delta)
+		case !delta.isZero():
+			result.Changed = append(result.Changed, delta)
+		}
+	}
+
+	for addr, balancesA := range a.Balances {
+		if !isDelegator(addr) {
+			continue
+		}
+		if _, ok := b.Balances[addr]; ok {
+			continue
+		}
+		result.Removed = append(result.Removed, DelegatorBalancesDelta{
+			Address:           addr,
+			DelegatedBalance:  balancesA.DelegatedBalance.Neg(),
+			StakedBalance:     balancesA.StakedBalance.Neg(),
+			OverstakedBalance: balancesA.OverstakedBalance.Neg(),
+		})
+	}
+
+	sortDeltasByMagnitude(result.Added)
+	sortDeltasByMagnitude(result.Removed)
+	sortDeltasByMagnitude(result.Changed)
+	return result
+}
+
+func CreateStoredDelegationStateFromDelegationState(state *DelegationState) *StoredDelegationState {
+	return &StoredDelegationState{
+		Delegate: Address{state.Baker},
+		Cycle:    state.Cycle,
+		Status:   DelegationStateStatusOk,
+		Balances: state.GetDelegatorAndBakerBalances(),
+
+		MinimumSearchStrategy: state.CreatedAt.Strategy,
+		MinimumResidual:       state.CreatedAt.Residual,
+		StakingParameters:     lo.FromPtr(state.Parameters),
+		CreatedAt:             state.CreatedAt,
+	}
+}
+
+// sha256 of the balances in a canonical form which does not depend on the json amount format
+func (j DelegatedBalances) Hash() string {
+	addresses := make([]tezos.Address, 0, len(j))
+	for address := range j {
+		addresses = append(addresses, address)
+	}
+	slices.SortFunc(addresses, func(a, b tezos.Address) int { return strings.Compare(a.String(), b.String()) })
+
+	hash := sha256.New()
+	for _, address := range addresses {
+		balances := j[address]
+		fmt.Fprintf(hash, "%s:%s:%s:%s\n", address, balances.DelegatedBalance, balances.OverstakedBalance, balances.StakedBalance)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
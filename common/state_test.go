@@ -0,0 +1,150 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestDiffDelegationStates(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	staying := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	unchanged := tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+	leaving := tezos.MustParseAddress("tz1S5WxdZR5f9NzsPXhr7L9L1vrEb5spZFur")
+	joiningSmall := tezos.MustParseAddress("tz1WzjeZrQm2JJT43rk7USfmnSQ2nLSebtta")
+	joiningBig := tezos.MustParseAddress("tz1eu3mkvEjzPgGoRMuKY7EHHtSwz88VxS31")
+	overstaking := tezos.MustParseAddress("tz1aKxnrzx5PXZJe7unufEswVRCMU9yafmfb")
+
+	a := &StoredDelegationState{
+		Delegate: Address{Address: baker},
+		Cycle:    745,
+		Balances: DelegatedBalances{
+			baker:       {DelegatedBalance: NewMutez(1000), StakedBalance: NewMutez(1000)},
+			staying:     {DelegatedBalance: NewMutez(500), StakedBalance: NewMutez(100), OverstakedBalance: NewMutez(10)},
+			unchanged:   {DelegatedBalance: NewMutez(300)},
+			leaving:     {DelegatedBalance: NewMutez(200)},
+			overstaking: {DelegatedBalance: NewMutez(1000), StakedBalance: NewMutez(100)},
+		},
+	}
+	b := &StoredDelegationState{
+		Delegate: Address{Address: baker},
+		Cycle:    746,
+		Balances: DelegatedBalances{
+			baker:        {DelegatedBalance: NewMutez(2000), StakedBalance: NewMutez(1000)},
+			staying:      {DelegatedBalance: NewMutez(400), StakedBalance: NewMutez(150), OverstakedBalance: NewMutez(20)},
+			unchanged:    {DelegatedBalance: NewMutez(300)},
+			joiningSmall: {DelegatedBalance: NewMutez(10)},
+			joiningBig:   {DelegatedBalance: NewMutez(20), StakedBalance: NewMutez(5)},
+			overstaking:  {DelegatedBalance: NewMutez(1000), StakedBalance: NewMutez(100), OverstakedBalance: NewMutez(500)},
+		},
+	}
+
+	diff := DiffDelegationStates(a, b)
+	assert.Equal(int64(745), diff.CycleA)
+	assert.Equal(int64(746), diff.CycleB)
+
+	assert.Equal([]DelegatorBalancesDelta{
+		{Address: joiningBig, DelegatedBalance: NewMutez(20), StakedBalance: NewMutez(5)},
+		{Address: joiningSmall, DelegatedBalance: NewMutez(10)},
+	}, diff.Added)
+	assert.Equal([]DelegatorBalancesDelta{
+		{Address: leaving, DelegatedBalance: NewMutez(-200)},
+	}, diff.Removed)
+	// changes of the overstaked balance alone are ordered by their size too
+	assert.Equal([]DelegatorBalancesDelta{
+		{Address: overstaking, OverstakedBalance: NewMutez(500)},
+		{Address: staying, DelegatedBalance: NewMutez(-100), StakedBalance: NewMutez(50), OverstakedBalance: NewMutez(10)},
+	}, diff.Changed)
+}
+
+func TestToUpcomingCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	staker := tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+
+	state := &StoredDelegationState{
+		Delegate: Address{Address: baker},
+		Cycle:    750,
+		Balances: DelegatedBalances{
+			baker:             {DelegatedBalance: NewMutez(1000), StakedBalance: NewMutez(1000)},
+			delegator:         {DelegatedBalance: NewMutez(1000)},
+			staker:            {StakedBalance: NewMutez(1000)},
+			tezos.BurnAddress: {DelegatedBalance: NewMutez(0)},
+		},
+	}
+
+	// baking power is 1000 + 1000 + (1000 + 1000) / 2
+	upcoming := state.ToUpcomingCycle(753, NewMutez(30_000))
+	assert.Equal(int64(753), upcoming.Cycle)
+	assert.Equal(int64(750), upcoming.OriginCycle)
+	assert.Equal(NewMutez(3000), upcoming.BakingPower)
+	assert.InDelta(0.1, upcoming.BakingPowerShare, 1e-9)
+	assert.Equal([]UpcomingDelegatorWeight{
+		{Address: staker, StakedBalance: NewMutez(1000), BakingPower: NewMutez(1000), Weight: 1.0 / 3},
+		{Address: delegator, DelegatedBalance: NewMutez(1000), BakingPower: NewMutez(500), Weight: 1.0 / 6},
+	}, upcoming.Delegators)
+
+	assert.Zero(state.ToUpcomingCycle(753, Mutez{}).BakingPowerShare)
+}
+
+func TestDiffDelegationStateVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+
+	a := &StoredDelegationState{
+		Delegate: Address{Address: baker},
+		Cycle:    745,
+		Version:  1,
+		Status:   DelegationStateStatusPartial,
+		Balances: DelegatedBalances{
+			baker: {DelegatedBalance: NewMutez(1000)},
+		},
+	}
+	b := &StoredDelegationState{
+		Delegate: Address{Address: baker},
+		Cycle:    745,
+		Version:  2,
+		Balances: DelegatedBalances{
+			baker:     {DelegatedBalance: NewMutez(1000)},
+			delegator: {DelegatedBalance: NewMutez(100)},
+		},
+	}
+
+	diff := DiffDelegationStateVersions(a, b)
+	assert.Equal(int64(1), diff.VersionA)
+	assert.Equal(int64(2), diff.VersionB)
+	assert.Equal(DelegationStateStatusPartial, diff.StatusA)
+	assert.Equal(DelegationStateStatusOk, diff.StatusB)
+	assert.Nil(diff.Baker)
+	assert.Equal([]DelegatorBalancesDelta{{Address: delegator, DelegatedBalance: NewMutez(100)}}, diff.Added)
+
+	// baker own balances are reported separately
+	b.Balances[baker] = DelegatorBalances{DelegatedBalance: NewMutez(900)}
+	diff = DiffDelegationStateVersions(a, b)
+	assert.Equal(&DelegatorBalancesDelta{Address: baker, DelegatedBalance: NewMutez(-100)}, diff.Baker)
+}
+
+func TestDelegatedBalancesHash(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	balances := DelegatedBalances{
+		baker:     {DelegatedBalance: NewMutez(1000), StakedBalance: NewMutez(500)},
+		delegator: {DelegatedBalance: NewMutez(100)},
+	}
+
+	hash := balances.Hash()
+	assert.Len(hash, 64)
+
+	balances[delegator] = DelegatorBalances{DelegatedBalance: NewMutez(101)}
+	assert.NotEqual(hash, balances.Hash())
+	assert.NotEqual(hash, DelegatedBalances{}.Hash())
+}
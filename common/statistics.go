@@ -3,13 +3,61 @@ package common
 import "github.com/trilitech/tzgo/tezos"
 
 type DelegateCycleStatistics struct {
-	ExternalStaked    int64 `json:"external_staked"`
-	OwnStaked         int64 `json:"own_staked"`
-	ExternalDelegated int64 `json:"external_delegated"`
-	OwnDelegated      int64 `json:"own_delegated"`
+	ExternalStaked     Mutez `json:"external_staked"`
+	OwnStaked          Mutez `json:"own_staked"`
+	ExternalDelegated  Mutez `json:"external_delegated"`
+	OwnDelegated       Mutez `json:"own_delegated"`
+	ExternalOverstaked Mutez `json:"external_overstaked"`
+	DelegatorsCount    int   `json:"delegators_count"`
+	BakingPower        Mutez `json:"baking_power"`
 }
 
 type CycleStatistics struct {
 	Cycle     int64                                     `json:"cycle"`
 	Delegates map[tezos.Address]DelegateCycleStatistics `json:"delegates"`
 }
+
+type Percentiles struct {
+	P10 Mutez `json:"p10"`
+	P25 Mutez `json:"p25"`
+	P50 Mutez `json:"p50"`
+	P75 Mutez `json:"p75"`
+	P90 Mutez `json:"p90"`
+	P99 Mutez `json:"p99"`
+}
+
+type LeaderboardEntry struct {
+	Delegate tezos.Address `json:"delegate"`
+	DelegateCycleStatistics
+}
+
+// differences against the previous cycle, nil if the previous cycle is not available
+type NetworkCycleStatisticsChange struct {
+	TotalStaked     Mutez `json:"total_staked"`
+	TotalDelegated  Mutez `json:"total_delegated"`
+	TotalOverstaked Mutez `json:"total_overstaked"`
+	DelegatesCount  int   `json:"delegates_count"`
+	DelegatorsCount int   `json:"delegators_count"`
+}
+
+type NetworkCycleStatistics struct {
+	Cycle           int64 `json:"cycle"`
+	DelegatesCount  int   `json:"delegates_count"`
+	DelegatorsCount int   `json:"delegators_count"`
+
+	TotalStaked     Mutez `json:"total_staked"`
+	TotalDelegated  Mutez `json:"total_delegated"`
+	TotalOverstaked Mutez `json:"total_overstaked"`
+	// sum of baking powers of stored delegates
+	TotalBakingPower Mutez `json:"total_baking_power"`
+
+	// distribution of baking power across delegates
+	BakingPowerPercentiles Percentiles `json:"baking_power_percentiles"`
+	// distribution of staked balance across external stakers
+	StakedBalancePercentiles Percentiles `json:"staked_balance_percentiles"`
+
+	TopBakersByExternalStake []LeaderboardEntry    `json:"top_bakers_by_external_stake"`
+	DelegatorsPerBaker       map[tezos.Address]int `json:"delegators_per_baker"`
+
+	Changes *NetworkCycleStatisticsChange `json:"changes,omitempty"`
+}
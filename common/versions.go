@@ -0,0 +1,70 @@
+package common
+
+import (
+	"time"
+
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type DelegationStateVersionReason string
+
+const (
+	DelegationStateVersionReasonFetch          DelegationStateVersionReason = "fetch"
+	DelegationStateVersionReasonForceRefetch   DelegationStateVersionReason = "force_refetch"
+	DelegationStateVersionReasonPartialRefetch DelegationStateVersionReason = "partial_refetch"
+	DelegationStateVersionReasonSnapshotImport DelegationStateVersionReason = "snapshot_import"
+	// state stored before states were versioned, recorded by the 0002 migration
+	DelegationStateVersionReasonUnversioned DelegationStateVersionReason = "unversioned"
+)
+
+type DelegationStateVersionInfo struct {
+	Version  int64                        `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Current  bool                         `json:"current" gorm:"column:is_current;index"`
+	Reason   DelegationStateVersionReason `json:"reason"`
+	StoredAt time.Time                    `json:"stored_at"`
+	Status   DelegationStateStatus        `json:"status"`
+	// sha256 of the balances, equal hashes mean equal answers
+	BalancesHash string `json:"balances_hash"`
+}
+
+// changes between two versions of the same state, baker own balances are reported separately
+type DelegationStateVersionDiff struct {
+	Delegate tezos.Address         `json:"delegate"`
+	Cycle    int64                 `json:"cycle"`
+	VersionA int64                 `json:"version_a"`
+	VersionB int64                 `json:"version_b"`
+	StatusA  DelegationStateStatus `json:"status_a"`
+	StatusB  DelegationStateStatus `json:"status_b"`
+	// nil if the baker own balances did not change
+	Baker   *DelegatorBalancesDelta  `json:"baker,omitempty"`
+	Added   []DelegatorBalancesDelta `json:"added"`
+	Removed []DelegatorBalancesDelta `json:"removed"`
+	Changed []DelegatorBalancesDelta `json:"changed"`
+}
+
+func DiffDelegationStateVersions(a, b *StoredDelegationState) *DelegationStateVersionDiff {
+	diff := DiffDelegationStates(a, b)
+	result := &DelegationStateVersionDiff{
+		Delegate: a.Delegate.Address,
+		Cycle:    a.Cycle,
+		VersionA: a.Version,
+		VersionB: b.Version,
+		StatusA:  a.Status,
+		StatusB:  b.Status,
+		Added:    diff.Added,
+		Removed:  diff.Removed,
+		Changed:  diff.Changed,
+	}
+
+	bakerA, bakerB := a.Balances[a.Delegate.Address], b.Balances[b.Delegate.Address]
+	baker := DelegatorBalancesDelta{
+		Address:           a.Delegate.Address,
+		DelegatedBalance:  bakerB.DelegatedBalance.Sub(bakerA.DelegatedBalance),
+		StakedBalance:     bakerB.StakedBalance.Sub(bakerA.StakedBalance),
+		OverstakedBalance: bakerB.OverstakedBalance.Sub(bakerA.OverstakedBalance),
+	}
+	if !baker.isZero() {
+		result.Baker = &baker
+	}
+	return result
+}
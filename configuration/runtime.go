@@ -29,12 +29,46 @@ type StorageConfiguration struct {
 	StoredCycles int                   `json:"stored_cycles"`
 }
 
+// used only when no tzkt provider is configured
+type UnstakeIndexerConfiguration struct {
+	// first level to index, defaults to a few cycles before the head
+	StartLevel int64 `json:"start_level"`
+}
+
+type MinimumSearchConfiguration struct {
+	// accepted difference between replayed balance and the minimum reported by the protocol, defaults to 1 mutez
+	Tolerance *int64 `json:"tolerance,omitempty"`
+	// strategies in the order they are tried, see common.MinimumSearchStrategy
+	Strategies []string `json:"strategies,omitempty"`
+	// closest match with larger residual is rejected, 0 means no limit
+	MaxResidual int64 `json:"max_residual"`
+}
+
+type FinalityConfiguration struct {
+	// blocks past the end of a cycle before the cycle is fetched, defaults to 2
+	Confirmations *int64 `json:"confirmations,omitempty"`
+	// how often block hashes recorded with stored states are checked against the canonical chain, defaults to 60
+	VerifyIntervalMinutes int64 `json:"verify_interval_minutes"`
+}
+
+// snapshots for air-gapped machines, the signing key is needed only for export
+type SnapshotConfiguration struct {
+	SigningKey  tezos.PrivateKey `json:"signing_key"`
+	TrustedKeys []tezos.Key      `json:"trusted_keys"`
+}
+
 type Runtime struct {
 	Providers          []string                                      `json:"providers"`
 	TzktProviders      []string                                      `json:"tzkt_providers"`
 	Database           DatabaseConfiguration                         `json:"database"`
 	Storage            StorageConfiguration                          `json:"storage"`
 	DiscordNotificator notifications.DiscordNotificatorConfiguration `json:"discord_notificator"`
+	UnstakeIndexer     UnstakeIndexerConfiguration                   `json:"unstake_indexer"`
+	NumericAmounts     bool                                          `json:"numeric_amounts"` // amounts as json numbers, legacy format
+	MinimumSearch      MinimumSearchConfiguration                    `json:"minimum_search"`
+	Snapshot           SnapshotConfiguration                         `json:"snapshot"`
+	Finality           FinalityConfiguration                         `json:"finality"`
+	Offline            bool                                          `json:"offline"` // serve stored states without rpc access
 	Delegates          []tezos.Address                               `json:"delegates,omitempty"`
 	LogLevel           slog.Level                                    `json:"-"`
 	Listen             string                                        `json:"-"`
@@ -65,6 +99,14 @@ func LoadConfiguration(path string) (*Runtime, error) {
 		runtimeConfig.Storage.StoredCycles = constants.STORED_CYCLES
 	}
 
+	if runtimeConfig.Finality.Confirmations == nil {
+		confirmations := int64(constants.FINALITY_CONFIRMATIONS)
+		runtimeConfig.Finality.Confirmations = &confirmations
+	}
+	if runtimeConfig.Finality.VerifyIntervalMinutes <= 0 {
+		runtimeConfig.Finality.VerifyIntervalMinutes = constants.FINALITY_VERIFY_INTERVAL_MINUTES
+	}
+
 	if err = godotenv.Load(); err != nil {
 		slog.Info("error loading .env file, loading env variables directly from environment or if not found load the defaults", "error", err)
 	}
@@ -75,6 +117,12 @@ func LoadConfiguration(path string) (*Runtime, error) {
 		runtimeConfig.Listen = constants.LISTEN_DEFAULT
 	}
 
+	if signingKey := os.Getenv(constants.SNAPSHOT_SIGNING_KEY); signingKey != "" {
+		if runtimeConfig.Snapshot.SigningKey, err = tezos.ParsePrivateKey(signingKey); err != nil {
+			return nil, err
+		}
+	}
+
 	runtimeConfig.PrivateListen = os.Getenv(constants.PRIVATE_LISTEN)
 	if runtimeConfig.PrivateListen == "" {
 		runtimeConfig.PrivateListen = constants.PRIVATE_LISTEN_DEFAULT
@@ -3,23 +3,79 @@ package constants
 const (
 	HTTP_CLIENT_TIMEOUT_SECONDS = 30
 
-	CYCLE_FETCH_FREQUENCY_MINUTES = 5
-	MINIMUM_DIFF_TOLERANCE        = 1
+	MINIMUM_DIFF_TOLERANCE = 1
 
 	RPC_INIT_BATCH_SIZE       = 3
 	DELEGATE_FETCH_BATCH_SIZE = 8
 	CONTRACT_FETCH_BATCH_SIZE = 50
 
+	// blocks are large, keep only a handful of them
+	BLOCK_CACHE_SIZE    = 64
+	CONTRACT_CACHE_SIZE = 50000
+
 	BALANCE_FETCH_RETRY_DELAY_SECONDS = 20
 	BALANCE_FETCH_RETRY_ATTEMPTS      = 3
 
+	DELEGATE_FETCH_TIMEOUT_MINUTES = 30
+	CYCLE_FETCH_TIMEOUT_MINUTES    = 12 * 60
+
+	SHUTDOWN_TIMEOUT_SECONDS = 60
+
+	DELEGATE_RETRY_CHECK_INTERVAL_MINUTES = 5
+	DELEGATE_RETRY_BASE_DELAY_MINUTES     = 10
+	DELEGATE_RETRY_MAX_DELAY_MINUTES      = 12 * 60
+	DELEGATE_RETRY_MAX_ATTEMPTS           = 10
+	DELEGATE_RETRY_BATCH_SIZE             = 50
+
+	TZKT_PAGE_SIZE = 10000
+
+	// heads are polled only when the node does not support monitoring
+	SCHEDULER_POLL_INTERVAL_SECONDS    = 30
+	SCHEDULER_RETRY_BASE_DELAY_SECONDS = 5
+	SCHEDULER_RETRY_MAX_DELAY_MINUTES  = 5
+
+	// previews of recently requested delegates are refreshed on new blocks
+	PREVIEW_TRACKING_MINUTES      = 30
+	PREVIEW_MAX_TRACKED_DELEGATES = 20
+	// previews are recomputed on request if they were not refreshed in time
+	PREVIEW_MAX_AGE_MINUTES = 5
+	// previews which are not tracked yet are computed on request, at most this many per minute
+	PREVIEW_MAX_COMPUTATIONS_PER_MINUTE = 10
+
+	// tenderbake blocks are final after 2 successors
+	FINALITY_CONFIRMATIONS           = 2
+	FINALITY_VERIFY_INTERVAL_MINUTES = 60
+
+	UNSTAKE_INDEXER_NAME                  = "unstake_requests"
+	UNSTAKE_INDEXER_FINALITY_DEPTH        = 2
+	UNSTAKE_INDEXER_BATCH_SIZE            = 20
+	UNSTAKE_INDEXER_POLL_INTERVAL_SECONDS = 30
+	UNSTAKE_INDEXER_DEFAULT_START_CYCLES  = 10
+
 	LOG_LEVEL              = "LOG_LEVEL"
 	LISTEN                 = "LISTEN"
 	LISTEN_DEFAULT         = "127.0.0.1:3000"
 	PRIVATE_LISTEN         = "PRIVATE_LISTEN"
 	PRIVATE_LISTEN_DEFAULT = ""
+	SNAPSHOT_SIGNING_KEY   = "SNAPSHOT_SIGNING_KEY"
 
 	STORED_CYCLES = 20
+
+	// -migrate targets besides an explicit schema version
+	MIGRATE_UP     = "up"
+	MIGRATE_DOWN   = "down"
+	MIGRATE_STATUS = "status"
+
+	MAX_BATCH_QUERY_DELEGATES = 400
+	MAX_BATCH_QUERY_CYCLES    = 50
+	MAX_HISTORY_CYCLES        = 100
+
+	STATISTICS_LEADERBOARD_SIZE = 50
+
+	SNAPSHOT_VERSION        = 1
+	SNAPSHOT_FILE_EXTENSION = ".prsnap"
+	// used to map cycles to their baking power origin when running offline without imported snapshots
+	DEFAULT_CONSENSUS_RIGHTS_DELAY = 2
 )
 
 type StorageKind string
@@ -7,6 +7,8 @@ var (
 	ErrCycleDidNotEndYet = errors.New("cycle did not end yet")
 
 	ErrDelegateHasNoMinimumDelegatedBalance = errors.New("delegate has no minimum delegated balance")
+	ErrDelegateDeactivated                  = errors.New("delegate is deactivated")
+	ErrDelegateHasZeroBalance               = errors.New("delegate has neither delegated nor staked balance")
 
 	ErrFailedToFetchContract                = errors.New("failed to fetch contract")
 	ErrFailedToFetchContractBalance         = errors.Join(ErrFailedToFetchContract, errors.New("failed to fetch contract balance"))
@@ -17,6 +19,38 @@ var (
 	ErrMinimumDelegatedBalanceNotFound      = errors.New("minimum delegated balance not found")
 	ErrFailedToFetchContractBalances        = errors.New("failed to fetch contract balances")
 	ErrDelegateNotRegistered                = errors.New("delegate not registered")
+	ErrEngineShuttingDown                   = errors.New("engine is shutting down")
+	ErrShutdownTimeout                      = errors.New("timed out waiting for running fetches")
+	ErrUnstakeRequestsCandidatesIncomplete  = errors.New("failed to fetch complete list of unstake requests candidates")
+	ErrUnstakeIndexerBehind                 = errors.New("unstake indexer has not indexed requested level")
+	ErrEngineOffline                        = errors.New("engine is running offline, rpc is not available")
+	ErrLastBlockHashMismatch                = errors.New("recorded last block of the cycle is not part of the canonical chain")
+
+	// snapshots
+
+	ErrSnapshotSigningKeyNotConfigured = errors.New("snapshot signing key not configured")
+	ErrSnapshotUntrustedSigner         = errors.New("snapshot signed by untrusted key")
+	ErrSnapshotInvalidSignature        = errors.New("invalid snapshot signature")
+	ErrSnapshotUnsupportedVersion      = errors.New("unsupported snapshot version")
+
+	// migrations
+
+	ErrSchemaNewerThanBinary     = errors.New("database schema is newer than the binary")
+	ErrMigrationChecksumMismatch = errors.New("applied migration does not match the embedded one")
+	ErrInvalidMigration          = errors.New("invalid migration")
+	ErrUnknownMigrationTarget    = errors.New("unknown migration target")
+
+	ErrTooManyDelegatesRequested = errors.New("too many delegates requested")
+	ErrTooManyCyclesRequested    = errors.New("too many cycles requested")
+	ErrInvalidCycleRange         = errors.New("invalid cycle range")
+	ErrMinimumNotAvailable       = errors.New("relevant minimum does not exists")
+
+	ErrTooManyPreviewComputations = errors.New("too many previews computed recently, try again later")
+
+	// client
+
+	ErrRequestFailed           = errors.New("request failed")
+	ErrPrivateApiNotConfigured = errors.New("private api url not configured")
 
 	// notifications
 
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type providerRecorderKey struct{}
+
+// collects providers which served the requests made with the context
+type providerRecorder struct {
+	mtx       sync.Mutex
+	providers map[string]struct{}
+}
+
+func withProviderRecorder(ctx context.Context) (context.Context, *providerRecorder) {
+	recorder := &providerRecorder{providers: make(map[string]struct{})}
+	return context.WithValue(ctx, providerRecorderKey{}, recorder), recorder
+}
+
+func recordProvider(ctx context.Context, provider string) {
+	recorder, ok := ctx.Value(providerRecorderKey{}).(*providerRecorder)
+	if !ok {
+		return
+	}
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+	recorder.providers[provider] = struct{}{}
+}
+
+func (r *providerRecorder) list() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	result := make([]string, 0, len(r.providers))
+	for provider := range r.providers {
+		result = append(result, provider)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func newFetchAudit(delegate tezos.Address, cycle int64, options *FetchOptions, providers []string, startedAt time.Time, state *common.StoredDelegationState, err error) *common.StoredFetchAudit {
+	audit := &common.StoredFetchAudit{
+		Delegate:   common.Address{Address: delegate},
+		Cycle:      cycle,
+		Options:    common.FetchAuditOptions{Force: options.Force, Debug: options.Debug},
+		Providers:  providers,
+		StartedAt:  startedAt,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+	}
+	if state != nil {
+		audit.Status = &state.Status
+		audit.ContractsCount = len(state.Balances)
+		audit.CreatedAt = state.CreatedAt
+		audit.BalancesHash = state.Balances.Hash()
+		audit.Version = state.Version
+	}
+	if err != nil {
+		audit.Error = err.Error()
+	}
+	return audit
+}
+
+// fetches of the delegate in the fetched cycle, oldest first
+func (e *Engine) GetFetchAudits(delegate tezos.Address, cycle int64) ([]common.StoredFetchAudit, error) {
+	return e.store.GetFetchAudits(delegate, cycle)
+}
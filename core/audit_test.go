@@ -0,0 +1,40 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestFetchAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	recordProvider(context.Background(), "https://ignored/") // contexts without recorder are ignored
+	ctx, providers := withProviderRecorder(context.Background())
+	recordProvider(ctx, "https://rpc.b/")
+	recordProvider(ctx, "https://rpc.a/")
+	recordProvider(ctx, "https://rpc.b/")
+	assert.Equal([]string{"https://rpc.a/", "https://rpc.b/"}, providers.list())
+
+	delegate := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	state := &common.StoredDelegationState{
+		Status:   common.DelegationStateStatusPartial,
+		Balances: common.DelegatedBalances{delegate: {DelegatedBalance: common.NewMutez(100)}},
+	}
+	audit := newFetchAudit(delegate, 750, &ForceFetchOptions, providers.list(), time.Now(), state, errors.New("failed"))
+	assert.True(audit.Options.Force)
+	assert.Equal(common.DelegationStateStatusPartial, *audit.Status)
+	assert.Equal(1, audit.ContractsCount)
+	assert.Equal(state.Balances.Hash(), audit.BalancesHash)
+	assert.Equal("failed", audit.Error)
+
+	// failed before a state was computed
+	audit = newFetchAudit(delegate, 750, &defaultFetchOptions, nil, time.Now(), nil, errors.New("failed"))
+	assert.Nil(audit.Status)
+	assert.Empty(audit.BalancesHash)
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+type cacheEntry struct {
+	key   string
+	value any
+}
+
+type inFlightRequest struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// bounded LRU cache of rpc responses, concurrent requests for the same key are coalesced into single fetch
+type responseCache struct {
+	mtx      sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	inFlight map[string]*inFlightRequest
+}
+
+func newResponseCache(capacity int) *responseCache {
+	return &responseCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inFlight: make(map[string]*inFlightRequest),
+	}
+}
+
+func (c *responseCache) Reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *responseCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *responseCache) add(key string, value any) {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// fetch runs with the context of the caller which started it, if that caller gives up the waiters fetch again on their own
+func (c *responseCache) getOrFetch(ctx context.Context, key string, fetch func() (any, error)) (any, error) {
+	for {
+		c.mtx.Lock()
+		if element, ok := c.entries[key]; ok {
+			c.order.MoveToFront(element)
+			c.mtx.Unlock()
+			return element.Value.(*cacheEntry).value, nil
+		}
+		request, ok := c.inFlight[key]
+		if !ok {
+			break
+		}
+		c.mtx.Unlock()
+
+		select {
+		case <-request.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if isContextError(request.err) && ctx.Err() == nil {
+			continue
+		}
+		return request.value, request.err
+	}
+	request := &inFlightRequest{done: make(chan struct{})}
+	c.inFlight[key] = request
+	c.mtx.Unlock()
+
+	request.value, request.err = fetch()
+
+	c.mtx.Lock()
+	delete(c.inFlight, key)
+	if request.err == nil { // errors are not cached
+		c.add(key, request.value)
+	}
+	c.mtx.Unlock()
+	close(request.done)
+
+	return request.value, request.err
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func cached[T any](ctx context.Context, cache *responseCache, key string, fetch func() (T, error)) (T, error) {
+	if cache == nil {
+		return fetch()
+	}
+
+	value, err := cache.getOrFetch(ctx, key, func() (any, error) {
+		return fetch()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), nil
+}
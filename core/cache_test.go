@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newResponseCache(2)
+	fetches := 0
+	fetch := func(value int) func() (int, error) {
+		return func() (int, error) {
+			fetches++
+			return value, nil
+		}
+	}
+
+	value, err := cached(defaultCtx, cache, "a", fetch(1))
+	assert.Nil(err)
+	assert.Equal(1, value)
+	cached(defaultCtx, cache, "b", fetch(2))
+	// a is most recently used now
+	value, _ = cached(defaultCtx, cache, "a", fetch(100))
+	assert.Equal(1, value)
+	cached(defaultCtx, cache, "c", fetch(3))
+
+	assert.Equal(2, cache.Len())
+	assert.Equal(3, fetches)
+
+	value, _ = cached(defaultCtx, cache, "b", fetch(20))
+	assert.Equal(20, value)
+	assert.Equal(4, fetches)
+
+	_, err = cached(defaultCtx, cache, "d", func() (int, error) { return 0, errors.New("failed") })
+	assert.NotNil(err)
+	value, err = cached(defaultCtx, cache, "d", fetch(4))
+	assert.Nil(err)
+	assert.Equal(4, value)
+
+	cache.Reset()
+	assert.Equal(0, cache.Len())
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newResponseCache(10)
+	var fetches atomic.Int32
+	release := make(chan struct{})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cached(defaultCtx, cache, "block", func() (string, error) {
+				fetches.Add(1)
+				<-release
+				return "block", nil
+			})
+			assert.Nil(err)
+			assert.Equal("block", value)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(int32(1), fetches.Load())
+}
+
+func TestResponseCacheCancelledLeader(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newResponseCache(10)
+	leaderCtx, cancelLeader := context.WithCancel(defaultCtx)
+	started := make(chan struct{})
+
+	leaderDone := make(chan error)
+	go func() {
+		_, err := cached(leaderCtx, cache, "block", func() (string, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return "", leaderCtx.Err()
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	waiterDone := make(chan string)
+	go func() {
+		value, err := cached(defaultCtx, cache, "block", func() (string, error) {
+			return "block", nil
+		})
+		assert.Nil(err)
+		waiterDone <- value
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancelLeader()
+	assert.ErrorIs(<-leaderDone, context.Canceled)
+	// the waiter is not failed by the cancellation of the leader, it fetches on its own
+	assert.Equal("block", <-waiterDone)
+	assert.Equal(1, cache.Len())
+}
+
+func TestCycleFetchesShareCache(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := &rpcCollector{blockCache: newResponseCache(10), contractCache: newResponseCache(10)}
+	collector.BeginCycleFetch()
+	collector.blockCache.add("block", "block")
+
+	// concurrent cycle fetch does not drop entries of the running one
+	collector.BeginCycleFetch()
+	assert.Equal(1, collector.blockCache.Len())
+	collector.EndCycleFetch()
+	collector.EndCycleFetch()
+
+	collector.BeginCycleFetch()
+	defer collector.EndCycleFetch()
+	assert.Equal(0, collector.blockCache.Len())
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -23,24 +24,48 @@ type rpcCollector struct {
 	rpcs     []*rpc.Client
 	tzktUrls []string
 	client   *http.Client
+
+	// blocks and contract snapshots are shared by many delegates of the same cycle
+	blockCache    *responseCache
+	contractCache *responseCache
+	// cycle fetches sharing the caches, see BeginCycleFetch
+	cycleFetchesMtx sync.Mutex
+	cycleFetches    int
+
+	// source of unstake requests candidates when there is no tzkt provider
+	indexer      *unstakeIndexer
+	tzktPageSize int
+
+	minimumSearch *minimumSearchOptions
+	// blocks past the end of a cycle before it is considered completed
+	confirmations int64
 }
 
-func attemptWithClients[T interface{}](clients []*rpc.Client, f func(client *rpc.Client) (T, error)) (T, error) {
+func attemptWithClients[T interface{}](ctx context.Context, clients []*rpc.Client, f func(client *rpc.Client) (T, error)) (T, error) {
 	var err error
 	var result T
 
 	// try 3 times
 	for i := 0; i < 3; i++ {
 		for _, client := range clients {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
 			result, err = f(client)
+			if errors.Is(err, constants.ErrDelegateNotRegistered) {
+				return result, err // other clients would report the same
+			}
 			if err != nil {
 				continue
 			}
+			recordProvider(ctx, client.BaseURL.String())
 			return result, nil
 		}
 		// sleep for some time
 		sleepTime := (rand.Intn(5)*(i+1) + 5)
-		time.Sleep(time.Duration(sleepTime) * time.Second)
+		if sleepErr := sleepWithContext(ctx, time.Duration(sleepTime)*time.Second); sleepErr != nil {
+			return result, errors.Join(err, sleepErr)
+		}
 	}
 	return result, err
 }
@@ -65,7 +90,9 @@ func initRpcClient(ctx context.Context, rpcUrl string, transport http.RoundTripp
 			break
 		}
 		slog.Debug("failed to init rpc client, retrying", "url", rpcUrl, "error", err.Error())
-		time.Sleep(time.Duration(rand.Intn(5)+5) * time.Second)
+		if sleepErr := sleepWithContext(ctx, time.Duration(rand.Intn(5)+5)*time.Second); sleepErr != nil {
+			return nil, errors.Join(err, sleepErr)
+		}
 	}
 	if err != nil {
 		slog.Debug("failed to init rpc client", "url", rpcUrl, "error", err.Error())
@@ -81,6 +108,11 @@ func newRpcCollector(ctx context.Context, rpcUrls []string, tzktUrls []string, t
 		client: &http.Client{
 			Timeout: constants.HTTP_CLIENT_TIMEOUT_SECONDS * time.Second,
 		},
+		blockCache:    newResponseCache(constants.BLOCK_CACHE_SIZE),
+		contractCache: newResponseCache(constants.CONTRACT_CACHE_SIZE),
+		tzktPageSize:  constants.TZKT_PAGE_SIZE,
+		minimumSearch: newMinimumSearchOptions(nil),
+		confirmations: constants.FINALITY_CONFIRMATIONS,
 	}
 
 	runInParallel(ctx, rpcUrls, constants.RPC_INIT_BATCH_SIZE, func(ctx context.Context, url string, mtx *sync.RWMutex) (cancel bool) {
@@ -103,13 +135,52 @@ func newRpcCollector(ctx context.Context, rpcUrls []string, tzktUrls []string, t
 	return result, nil
 }
 
+// drops cached responses of previous cycles when no other cycle fetch is using them
+func (engine *rpcCollector) BeginCycleFetch() {
+	engine.cycleFetchesMtx.Lock()
+	defer engine.cycleFetchesMtx.Unlock()
+
+	if engine.cycleFetches == 0 {
+		engine.blockCache.Reset()
+		engine.contractCache.Reset()
+	}
+	engine.cycleFetches++
+}
+
+func (engine *rpcCollector) EndCycleFetch() {
+	engine.cycleFetchesMtx.Lock()
+	defer engine.cycleFetchesMtx.Unlock()
+
+	engine.cycleFetches--
+}
+
+func (engine *rpcCollector) getBlock(ctx context.Context, id rpc.BlockID) (*rpc.Block, error) {
+	return cached(ctx, engine.blockCache, id.String(), func() (*rpc.Block, error) {
+		return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
+			return client.GetBlock(ctx, id)
+		})
+	})
+}
+
+func (engine *rpcCollector) getContractBalance(ctx context.Context, addr tezos.Address, id rpc.BlockID) (tezos.Z, error) {
+	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/balance", id, addr)
+
+	return cached(ctx, engine.contractCache, u, func() (tezos.Z, error) {
+		return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (tezos.Z, error) {
+			return client.GetContractBalance(ctx, addr, id)
+		})
+	})
+}
+
 func (engine *rpcCollector) getContractStakedBalance(ctx context.Context, addr tezos.Address, id rpc.BlockID) (tezos.Z, error) {
 	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/staked_balance", id, addr)
 
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (tezos.Z, error) {
-		var bal tezos.Z
-		err := client.Get(ctx, u, &bal)
-		return bal, err
+	return cached(ctx, engine.contractCache, u, func() (tezos.Z, error) {
+		return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (tezos.Z, error) {
+			var bal tezos.Z
+			err := client.Get(ctx, u, &bal)
+			return bal, err
+		})
 	})
 }
 
@@ -117,27 +188,31 @@ func (engine *rpcCollector) getContractUnstakeRequests(ctx context.Context, addr
 	// chains/main/blocks/5896790/context/contracts/tz1epK8fDnc8tUeK6dNwTjiHqrGzX586ozyt/unstake_requests
 	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/unstake_requests", id, addr)
 
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (common.UnstakeRequests, error) {
-		var requests common.UnstakeRequests
-		err := client.Get(ctx, u, &requests)
-		return requests, err
+	return cached(ctx, engine.contractCache, u, func() (common.UnstakeRequests, error) {
+		return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (common.UnstakeRequests, error) {
+			var requests common.UnstakeRequests
+			err := client.Get(ctx, u, &requests)
+			return requests, err
+		})
 	})
 }
 
 func (engine *rpcCollector) getContractDelegate(ctx context.Context, addr tezos.Address, id rpc.BlockID) (tezos.Address, error) {
 	u := fmt.Sprintf("chains/main/blocks/%s/context/contracts/%s/delegate", id, addr)
 
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (tezos.Address, error) {
-		var addr tezos.Address
-		err := client.Get(ctx, u, &addr)
-		return addr, err
+	return cached(ctx, engine.contractCache, u, func() (tezos.Address, error) {
+		return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (tezos.Address, error) {
+			var addr tezos.Address
+			err := client.Get(ctx, u, &addr)
+			return addr, err
+		})
 	})
 }
 
 func (engine *rpcCollector) getDelegateActiveStakingParameters(ctx context.Context, addr tezos.Address, id rpc.BlockID) (*common.StakingParameters, error) {
 	u := fmt.Sprintf("chains/main/blocks/%s/context/delegates/%s/active_staking_parameters", id, addr)
 
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (*common.StakingParameters, error) {
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*common.StakingParameters, error) {
 		var params common.StakingParameters
 		err := client.Get(ctx, u, &params)
 		return &params, err
@@ -147,7 +222,7 @@ func (engine *rpcCollector) getDelegateActiveStakingParameters(ctx context.Conte
 func (engine *rpcCollector) getDelegateDelegatedContracts(ctx context.Context, addr tezos.Address, id rpc.BlockID) ([]tezos.Address, error) {
 	u := fmt.Sprintf("chains/main/blocks/%s/context/delegates/%s/delegated_contracts", id, addr)
 
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) ([]tezos.Address, error) {
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) ([]tezos.Address, error) {
 		var delegatedContracts []tezos.Address
 		err := client.Get(ctx, u, &delegatedContracts)
 		if err != nil {
@@ -170,9 +245,9 @@ func (engine *rpcCollector) getDelegateDelegatedContracts(ctx context.Context, a
 	})
 }
 
-func (engine *rpcCollector) GetCurrentProtocol() (tezos.ProtocolHash, error) {
-	params, err := attemptWithClients(engine.rpcs, func(client *rpc.Client) (*tezos.Params, error) {
-		return client.GetParams(context.Background(), rpc.Head)
+func (engine *rpcCollector) GetCurrentProtocol(ctx context.Context) (tezos.ProtocolHash, error) {
+	params, err := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*tezos.Params, error) {
+		return client.GetParams(ctx, rpc.Head)
 	})
 	if err != nil {
 		return tezos.ZeroProtocolHash, err
@@ -180,8 +255,25 @@ func (engine *rpcCollector) GetCurrentProtocol() (tezos.ProtocolHash, error) {
 	return params.Protocol, nil
 }
 
+func (engine *rpcCollector) GetBlockHeader(ctx context.Context, id rpc.BlockID) (*rpc.BlockHeader, error) {
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.BlockHeader, error) {
+		return client.GetBlockHeader(ctx, id)
+	})
+}
+
+// cached, all delegates of a cycle record the hash of the same block
+func (engine *rpcCollector) getBlockHash(ctx context.Context, id rpc.BlockID) (tezos.BlockHash, error) {
+	header, err := cached(ctx, engine.blockCache, "header/"+id.String(), func() (*rpc.BlockHeader, error) {
+		return engine.GetBlockHeader(ctx, id)
+	})
+	if err != nil {
+		return tezos.ZeroBlockHash, err
+	}
+	return header.Hash, nil
+}
+
 func (engine *rpcCollector) GetLastCompletedCycle(ctx context.Context) (cycle int64, lastBlockLevel int64, err error) {
-	head, err := attemptWithClients(engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
+	head, err := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
 		return client.GetHeadBlock(ctx)
 	})
 	if err != nil {
@@ -192,11 +284,41 @@ func (engine *rpcCollector) GetLastCompletedCycle(ctx context.Context) (cycle in
 	previousCycle := levelInfo.Cycle - 1
 	lastBlockInPreviousCycle := head.Header.Level - levelInfo.CyclePosition - 1
 
+	// the last block of the previous cycle is not final yet, the cycle before is the last completed one
+	if head.Header.Level-lastBlockInPreviousCycle < engine.confirmations {
+		slog.Debug("last cycle is not final yet", "cycle", previousCycle, "head", head.Header.Level, "confirmations", engine.confirmations)
+		return previousCycle - 1, engine.determineLastBlockOfCycle(ctx, previousCycle-1), nil
+	}
+
 	return previousCycle, lastBlockInPreviousCycle, err
 }
 
+// not cached, the head moves
+func (engine *rpcCollector) getHeadBlock(ctx context.Context) (*rpc.Block, error) {
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
+		return client.GetHeadBlock(ctx)
+	})
+}
+
+// next cycle to become final and its last block, mirrors GetLastCompletedCycle
+func (engine *rpcCollector) GetNextCycleEnd(ctx context.Context) (cycle int64, lastBlockLevel int64, err error) {
+	head, err := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
+		return client.GetHeadBlock(ctx)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	blocksPerCycle, _ := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (int64, error) {
+		return client.Params.BlocksPerCycle, nil
+	})
+
+	levelInfo := head.GetLevelInfo()
+	cycle, lastBlockLevel = nextCycleEnd(head.Header.Level, levelInfo.Cycle, levelInfo.CyclePosition, blocksPerCycle, engine.confirmations)
+	return cycle, lastBlockLevel, nil
+}
+
 func (engine *rpcCollector) GetCycleBakingPowerOrigin(ctx context.Context, cycle int64) (originCycle int64) {
-	consensusDelay, _ := attemptWithClients(engine.rpcs, func(client *rpc.Client) (int64, error) {
+	consensusDelay, _ := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (int64, error) {
 		return client.Params.ConsensusRightsDelay, nil
 	})
 
@@ -205,8 +327,8 @@ func (engine *rpcCollector) GetCycleBakingPowerOrigin(ctx context.Context, cycle
 	return cycle - 1 - consensusDelay
 }
 
-func (engine *rpcCollector) determineLastBlockOfCycle(cycle int64) int64 {
-	height, _ := attemptWithClients(engine.rpcs, func(client *rpc.Client) (int64, error) {
+func (engine *rpcCollector) determineLastBlockOfCycle(ctx context.Context, cycle int64) int64 {
+	height, _ := attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (int64, error) {
 		return client.Params.CycleEndHeight(cycle), nil
 	})
 
@@ -214,14 +336,18 @@ func (engine *rpcCollector) determineLastBlockOfCycle(cycle int64) int64 {
 }
 
 func (engine *rpcCollector) GetActiveDelegatesFromCycle(ctx context.Context, lastBlockInTheCycle rpc.BlockID) (rpc.DelegateList, error) {
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (rpc.DelegateList, error) {
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (rpc.DelegateList, error) {
 		return client.ListActiveDelegates(ctx, lastBlockInTheCycle)
 	})
 }
 
 func (engine *rpcCollector) GetDelegateFromCycle(ctx context.Context, lastBlockInTheCycle rpc.BlockID, delegateAddress tezos.Address) (*rpc.Delegate, error) {
-	return attemptWithClients(engine.rpcs, func(client *rpc.Client) (*rpc.Delegate, error) {
-		return client.GetDelegate(ctx, delegateAddress, lastBlockInTheCycle)
+	return attemptWithClients(ctx, engine.rpcs, func(client *rpc.Client) (*rpc.Delegate, error) {
+		delegate, err := client.GetDelegate(ctx, delegateAddress, lastBlockInTheCycle)
+		if rpc.ErrorStatus(err) == http.StatusNotFound || (err != nil && strings.Contains(err.Error(), "delegate.not_registered")) {
+			return nil, errors.Join(constants.ErrDelegateNotRegistered, err)
+		}
+		return delegate, err
 	})
 }
 
@@ -229,9 +355,7 @@ func (engine *rpcCollector) GetDelegateFromCycle(ctx context.Context, lastBlockI
 func (engine *rpcCollector) fetchContractInitialBalanceInfo(ctx context.Context, address tezos.Address, baker tezos.Address, blockWithMinimumId rpc.BlockID, lastBlockInCycle rpc.BlockID) (*common.DelegationStateBalanceInfo, error) {
 	blockBeforeMinimumId := rpc.NewBlockOffset(blockWithMinimumId, -1)
 
-	balance, err := attemptWithClients(engine.rpcs, func(client *rpc.Client) (tezos.Z, error) {
-		return client.GetContractBalance(ctx, address, blockBeforeMinimumId)
-	})
+	balance, err := engine.getContractBalance(ctx, address, blockBeforeMinimumId)
 	if err != nil {
 		if httpStatus, ok := err.(rpc.HTTPStatus); ok && httpStatus.StatusCode() == http.StatusNotFound {
 			return &common.DelegationStateBalanceInfo{}, nil
@@ -249,6 +373,15 @@ func (engine *rpcCollector) fetchContractInitialBalanceInfo(ctx context.Context,
 		}
 	}
 
+	// originated contracts (KT1) can not stake, their stake and unstake requests are always empty
+	if address.IsContract() {
+		return &common.DelegationStateBalanceInfo{
+			Balance:    common.NewMutezFromZ(balance),
+			Baker:      delegate,
+			StakeBaker: delegate,
+		}, nil
+	}
+
 	unstakeRequests, err := engine.getContractUnstakeRequests(ctx, address, blockBeforeMinimumId)
 	if err != nil {
 		return nil, errors.Join(constants.ErrFailedToFetchContractUnstakeRequests, err)
@@ -269,52 +402,148 @@ func (engine *rpcCollector) fetchContractInitialBalanceInfo(ctx context.Context,
 	}
 
 	return &common.DelegationStateBalanceInfo{
-		Balance:         balance.Int64(),
-		StakedBalance:   stakedBalance.Int64(),
+		Balance:         common.NewMutezFromZ(balance),
+		StakedBalance:   common.NewMutezFromZ(stakedBalance),
 		UnstakedBalance: unstakeRequests.GetUnstakedTotalForBaker(baker),
 		Baker:           delegate,
 		StakeBaker:      stakeDelegate,
 	}, nil
 }
 
-func (engine *rpcCollector) getUnstakeRequestsCandidates(delegate tezos.Address, blockLevel int64) ([]tezos.Address, error) {
-	var result []tezos.Address
-	var err error
+// stake and unstake requests of the stakers of the delegate at the end of the cycle
+func (engine *rpcCollector) GetStakerLedger(ctx context.Context, state *common.DelegationState, lastBlockInTheCycle rpc.BlockID) ([]common.StakerLedgerEntry, error) {
+	stakers := state.GetStakers()
+	result := make([]common.StakerLedgerEntry, 0, len(stakers))
+	var failed error
+	runInParallel(ctx, stakers, constants.CONTRACT_FETCH_BATCH_SIZE, func(ctx context.Context, staker tezos.Address, mtx *sync.RWMutex) bool {
+		fail := func(err error) bool {
+			mtx.Lock()
+			defer mtx.Unlock()
+			failed = errors.Join(constants.ErrFailedToFetchContractUnstakeRequests, err)
+			return true
+		}
 
-	// try 3 times
-	for i := 0; i < 3; i++ {
-		for _, clientUrl := range engine.tzktUrls {
-			url := fmt.Sprintf("%sv1/staking/unstake_requests?firstLevel.le=%d&baker=%s&select=staker.address&staker.ne=%s&staker.null=false&limit=10000", clientUrl, blockLevel, delegate.String(), delegate.String())
-			slog.Debug("fetching unstake requests candidates", "url", url)
-			response, err := engine.client.Get(url)
-			if err != nil {
-				continue
+		stakedBalance, err := engine.getContractStakedBalance(ctx, staker, lastBlockInTheCycle)
+		if err != nil {
+			return fail(err)
+		}
+		unstakeRequests, err := engine.getContractUnstakeRequests(ctx, staker, lastBlockInTheCycle)
+		if err != nil {
+			return fail(err)
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		result = append(result, common.StakerLedgerEntry{
+			Staker:        staker,
+			Baker:         state.Baker,
+			Cycle:         state.Cycle,
+			StakedBalance: common.NewMutezFromZ(stakedBalance),
+			Requests:      unstakeRequests.GetRequestsForBaker(state.Baker),
+		})
+		return false
+	})
+	if failed != nil {
+		return nil, failed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type tzktUnstakeRequest struct {
+	Id     int64 `json:"id"`
+	Staker struct {
+		Address string `json:"address"`
+	} `json:"staker"`
+}
+
+func (engine *rpcCollector) getTzktUnstakeRequestsPage(ctx context.Context, tzktUrl string, delegate tezos.Address, blockLevel int64, lastId int64) ([]tzktUnstakeRequest, error) {
+	url := fmt.Sprintf("%sv1/staking/unstake_requests?firstLevel.le=%d&baker=%s&staker.ne=%s&staker.null=false&select=id,staker&sort.asc=id&offset.cr=%d&limit=%d", tzktUrl, blockLevel, delegate.String(), delegate.String(), lastId, engine.tzktPageSize)
+	slog.Debug("fetching unstake requests candidates", "url", url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := engine.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status code %d from %s", response.StatusCode, tzktUrl)
+	}
+
+	var page []tzktUnstakeRequest
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// walks all pages of unstake requests, either all candidates are returned or an error
+func (engine *rpcCollector) getTzktUnstakeRequestsCandidates(ctx context.Context, tzktUrl string, delegate tezos.Address, blockLevel int64) ([]tezos.Address, error) {
+	result := make([]tezos.Address, 0)
+	seen := make(map[tezos.Address]struct{})
+
+	lastId := int64(0)
+	for {
+		page, err := engine.getTzktUnstakeRequestsPage(ctx, tzktUrl, delegate, blockLevel, lastId)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, request := range page {
+			if request.Id <= lastId {
+				return nil, fmt.Errorf("unstake requests are not sorted by id, got %d after %d", request.Id, lastId)
 			}
+			lastId = request.Id
 
-			if response.StatusCode/100 != 2 {
+			addr, err := tezos.ParseAddress(request.Staker.Address)
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("invalid staker address of unstake request %d", request.Id), err)
+			}
+			if _, ok := seen[addr]; ok {
 				continue
 			}
-			candidates := make([]string, 0, len(result))
-			defer response.Body.Close()
-			err = json.NewDecoder(response.Body).Decode(&candidates)
+			seen[addr] = struct{}{}
+			result = append(result, addr)
+		}
+
+		if len(page) < engine.tzktPageSize {
+			return result, nil
+		}
+	}
+}
 
+func (engine *rpcCollector) getUnstakeRequestsCandidates(ctx context.Context, delegate tezos.Address, blockLevel int64) ([]tezos.Address, error) {
+	if len(engine.tzktUrls) == 0 && engine.indexer != nil {
+		recordProvider(ctx, "indexer")
+		return engine.indexer.GetUnstakeRequestsCandidates(ctx, delegate, blockLevel)
+	}
+
+	var err error
+	// try 3 times
+	for i := 0; i < 3; i++ {
+		for _, clientUrl := range engine.tzktUrls {
+			var result []tezos.Address
+			result, err = engine.getTzktUnstakeRequestsCandidates(ctx, clientUrl, delegate, blockLevel)
 			if err != nil {
+				slog.Debug("failed to fetch unstake requests candidates", "url", clientUrl, "delegate", delegate.String(), "error", err.Error())
 				continue
 			}
-			for _, address := range candidates {
-				addr, err := tezos.ParseAddress(address)
-				if err != nil {
-					continue
-				}
-				result = append(result, addr)
-			}
+			recordProvider(ctx, clientUrl)
 			return result, nil
 		}
 		// sleep for some time
 		sleepTime := (rand.Intn(5)*(i+1) + 5)
-		time.Sleep(time.Duration(sleepTime) * time.Second)
+		if sleepErr := sleepWithContext(ctx, time.Duration(sleepTime)*time.Second); sleepErr != nil {
+			return nil, errors.Join(constants.ErrUnstakeRequestsCandidatesIncomplete, err, sleepErr)
+		}
 	}
-	return result, err
+	return nil, errors.Join(constants.ErrUnstakeRequestsCandidatesIncomplete, err)
 }
 
 // we fetch the previous block to get the state at the beginning of the block we are going to process
@@ -330,15 +559,18 @@ func (engine *rpcCollector) fetchInitialDelegationState(ctx context.Context, del
 	state.Parameters = params
 
 	// but we fill the rest from delegate state at the beginning of the block
+	// status errors are reported along with the state
+	var statusErr error
 	delegateDelegatedContracts, err := engine.getDelegateDelegatedContracts(ctx, delegate.Delegate, blockBeforeMinimumId)
 	switch err {
-	case constants.ErrDelegateNotRegistered: // ignore
+	case constants.ErrDelegateNotRegistered:
+		statusErr = errors.Join(constants.ErrDelegateNotRegistered, fmt.Errorf("delegate was not registered at level %s", blockBeforeMinimumId))
 	case nil: // ignore
 	default:
 		return nil, err
 	}
 	// get potential unstake requests candidates
-	unstakeRequestsCandidates, err := engine.getUnstakeRequestsCandidates(delegate.Delegate, blockWithMinimumId.Int64())
+	unstakeRequestsCandidates, err := engine.getUnstakeRequestsCandidates(ctx, delegate.Delegate, blockWithMinimumId.Int64())
 	if err != nil {
 		return nil, err
 	}
@@ -351,9 +583,7 @@ func (engine *rpcCollector) fetchInitialDelegationState(ctx context.Context, del
 	}
 	delegateDelegatedContracts = lo.Uniq(append(delegateDelegatedContracts, delegateDelegatedContractsAtTheEndOfCycle...))
 
-	balance, err := attemptWithClients(engine.rpcs, func(client *rpc.Client) (tezos.Z, error) {
-		return client.GetContractBalance(ctx, delegate.Delegate, blockBeforeMinimumId)
-	})
+	balance, err := engine.getContractBalance(ctx, delegate.Delegate, blockBeforeMinimumId)
 	if err != nil {
 		return nil, errors.Join(constants.ErrFailedToFetchContract, err)
 	}
@@ -370,8 +600,8 @@ func (engine *rpcCollector) fetchInitialDelegationState(ctx context.Context, del
 	}
 
 	state.AddBalance(delegate.Delegate, common.DelegationStateBalanceInfo{
-		Balance:         balance.Int64(),
-		StakedBalance:   stakedBalance.Int64(),
+		Balance:         common.NewMutezFromZ(balance),
+		StakedBalance:   common.NewMutezFromZ(stakedBalance),
 		UnstakedBalance: unstakeRequests.GetUnstakedTotal(),
 		Baker:           delegate.Delegate,
 		StakeBaker:      delegate.Delegate,
@@ -407,14 +637,27 @@ func (engine *rpcCollector) fetchInitialDelegationState(ctx context.Context, del
 			break
 		}
 
-		time.Sleep(constants.BALANCE_FETCH_RETRY_DELAY_SECONDS * time.Second)
+		if err := sleepWithContext(ctx, constants.BALANCE_FETCH_RETRY_DELAY_SECONDS*time.Second); err != nil {
+			return nil, err
+		}
 	}
 
 	if len(toCollect) > 0 {
-		return nil, constants.ErrFailedToFetchContractBalances
+		// kept so the state can be inspected, it is refetched until complete
+		failed := lo.Map(toCollect, func(address tezos.Address, _ int) string { return address.String() })
+		slices.Sort(failed)
+		statusErr = joinStatusErrors(statusErr, errors.Join(constants.ErrFailedToFetchContractBalances, fmt.Errorf("%d contracts failed: %s", len(failed), strings.Join(failed, ", "))))
 	}
 
-	return state, nil
+	return state, statusErr
+}
+
+// a single status error is kept as is so it can be compared directly
+func joinStatusErrors(err error, status error) error {
+	if err == nil {
+		return status
+	}
+	return errors.Join(err, status)
 }
 
 func makeBurnAndStakeBalanceUpdatesLast(updates []PRBalanceUpdate) []PRBalanceUpdate {
@@ -441,12 +684,49 @@ func makeBurnAndStakeBalanceUpdatesLast(updates []PRBalanceUpdate) []PRBalanceUp
 	return append(regular, toBeLast...)
 }
 
-func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *common.DelegationState, blockLevelWithMinimumBalance rpc.BlockLevel) (PRBalanceUpdates, error) {
+// adds the contract to the state with its balance at the beginning of the block if it is not tracked yet
+func (engine *rpcCollector) ensureContractBalanceInfo(ctx context.Context, state *common.DelegationState, address tezos.Address, blockLevelWithMinimumBalance rpc.BlockLevel, lastBlockInCycle rpc.BlockID) error {
+	if state.HasContractBalanceInfo(address) {
+		return nil
+	}
+	balanceInfo, err := engine.fetchContractInitialBalanceInfo(ctx, address, state.Baker, blockLevelWithMinimumBalance, lastBlockInCycle)
+	if err != nil {
+		return err
+	}
+	state.AddBalance(address, *balanceInfo)
+	return nil
+}
+
+// contracts originated with a delegate are delegated from the start, the delegation precedes the transfer of the initial balance
+func getOriginationDelegationUpdates(state *common.DelegationState, delegate tezos.Address, result rpc.OperationResult) []PRBalanceUpdate {
+	if !result.Status.IsSuccess() || !delegate.Equal(state.Baker) {
+		return nil
+	}
+
+	updates := make([]PRBalanceUpdate, 0, len(result.OriginatedContracts))
+	for _, contract := range result.OriginatedContracts {
+		if !state.HasContractBalanceInfo(contract) {
+			// the contract did not exist at the beginning of the block
+			state.AddBalance(contract, common.DelegationStateBalanceInfo{})
+		}
+		updates = append(updates, PRBalanceUpdate{
+			Address:  contract,
+			Source:   common.CreatedOnDelegation,
+			Delegate: delegate,
+		})
+	}
+	return updates
+}
+
+func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *common.DelegationState, blockLevelWithMinimumBalance rpc.BlockLevel, ordering balanceUpdatesOrdering) (PRBalanceUpdates, error) {
 	lastBlockInCycle := state.LastBlockLevel
 
-	blockWithMinimumBalance, err := attemptWithClients(engine.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
-		return client.GetBlock(ctx, blockLevelWithMinimumBalance)
-	})
+	reorder := makeBurnAndStakeBalanceUpdatesLast
+	if ordering == balanceUpdatesOrderingNode {
+		reorder = func(updates []PRBalanceUpdate) []PRBalanceUpdate { return updates }
+	}
+
+	blockWithMinimumBalance, err := engine.getBlock(ctx, blockLevelWithMinimumBalance)
 	if err != nil {
 		return nil, err
 	}
@@ -471,19 +751,19 @@ func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *c
 
 			// then transfers
 			for transactionIndex, content := range operation.Contents {
+				if status := content.Result().Status; status.IsValid() && !status.IsSuccess() {
+					// backtracked and failed operations keep only their fees, other balance updates were never applied
+					continue
+				}
+
 				if content.Kind() == tezos.OpTypeDelegation {
 					content, ok := content.(*rpc.Delegation)
 					if !ok {
-						slog.Debug("delegation op with invalid content", "operation", operation.Hash)
+						return nil, fmt.Errorf("delegation operation %s with invalid content", operation.Hash)
 					}
 
-					if !state.HasContractBalanceInfo(content.Source) {
-						// fetch
-						balanceInfo, err := engine.fetchContractInitialBalanceInfo(ctx, content.Source, state.Baker, blockLevelWithMinimumBalance, lastBlockInCycle)
-						if err != nil {
-							return nil, err
-						}
-						state.AddBalance(content.Source, *balanceInfo)
+					if err := engine.ensureContractBalanceInfo(ctx, state, content.Source, blockLevelWithMinimumBalance, lastBlockInCycle); err != nil {
+						return nil, err
 					}
 
 					allBalanceUpdates = allBalanceUpdates.Add(PRBalanceUpdate{
@@ -497,7 +777,16 @@ func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *c
 					continue
 				}
 
-				allBalanceUpdates = allBalanceUpdates.Add(makeBurnAndStakeBalanceUpdatesLast(lo.Map(content.Result().BalanceUpdates, func(bu rpc.BalanceUpdate, _ int) PRBalanceUpdate {
+				if origination, ok := content.(*rpc.Origination); ok && origination.Delegate != nil {
+					updates := getOriginationDelegationUpdates(state, *origination.Delegate, content.Result())
+					allBalanceUpdates = allBalanceUpdates.Add(lo.Map(updates, func(update PRBalanceUpdate, _ int) PRBalanceUpdate {
+						update.Operation = operation.Hash
+						update.Index = transactionIndex
+						return update
+					})...)
+				}
+
+				allBalanceUpdates = allBalanceUpdates.Add(reorder(lo.Map(content.Result().BalanceUpdates, func(bu rpc.BalanceUpdate, _ int) PRBalanceUpdate {
 					return PRBalanceUpdate{
 						Address:   bu.Address(),
 						Amount:    bu.Amount(),
@@ -509,15 +798,16 @@ func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *c
 					}
 				}))...)
 
+				// internal operations are emitted by smart contracts (KT1), they can delegate, originate and transfer on their own
 				for internalResultIndex, internalResult := range content.Meta().InternalResults {
+					if !internalResult.Result.Status.IsSuccess() {
+						// backtracked and failed results report balance updates which were never applied
+						continue
+					}
+
 					if internalResult.Kind == tezos.OpTypeDelegation {
-						if !state.HasContractBalanceInfo(internalResult.Source) {
-							// fetch
-							balanceInfo, err := engine.fetchContractInitialBalanceInfo(ctx, internalResult.Source, state.Baker, blockLevelWithMinimumBalance, lastBlockInCycle)
-							if err != nil {
-								return nil, err
-							}
-							state.AddBalance(internalResult.Source, *balanceInfo)
+						if err := engine.ensureContractBalanceInfo(ctx, state, internalResult.Source, blockLevelWithMinimumBalance, lastBlockInCycle); err != nil {
+							return nil, err
 						}
 						delegate := tezos.ZeroAddress
 						if internalResult.Delegate != nil {
@@ -525,16 +815,27 @@ func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *c
 						}
 
 						allBalanceUpdates = allBalanceUpdates.Add(PRBalanceUpdate{
-							Address:   internalResult.Source,
-							Operation: operation.Hash,
-							Index:     transactionIndex,
-							Source:    common.CreatedOnDelegation,
-							Delegate:  delegate,
+							Address:       internalResult.Source,
+							Operation:     operation.Hash,
+							Index:         transactionIndex,
+							InternalIndex: internalResultIndex,
+							Source:        common.CreatedOnDelegation,
+							Delegate:      delegate,
 						})
 						// no other updates nor internal results for delegation
 						continue
 					}
-					allBalanceUpdates = allBalanceUpdates.Add(makeBurnAndStakeBalanceUpdatesLast(lo.Map(internalResult.Result.BalanceUpdates, func(bu rpc.BalanceUpdate, _ int) PRBalanceUpdate {
+
+					if internalResult.Kind == tezos.OpTypeOrigination && internalResult.Delegate != nil {
+						updates := getOriginationDelegationUpdates(state, *internalResult.Delegate, internalResult.Result)
+						allBalanceUpdates = allBalanceUpdates.Add(lo.Map(updates, func(update PRBalanceUpdate, _ int) PRBalanceUpdate {
+							update.Operation = operation.Hash
+							update.Index = transactionIndex
+							update.InternalIndex = internalResultIndex
+							return update
+						})...)
+					}
+					allBalanceUpdates = allBalanceUpdates.Add(reorder(lo.Map(internalResult.Result.BalanceUpdates, func(bu rpc.BalanceUpdate, _ int) PRBalanceUpdate {
 						return PRBalanceUpdate{
 							Address:       bu.Address(),
 							Amount:        bu.Amount(),
@@ -584,10 +885,15 @@ func (engine *rpcCollector) getBlockBalanceUpdates(ctx context.Context, state *c
 	}
 	//  for some reason updates caused by unstake deposits -> deposits are not considered ¯\_(ツ)_/¯
 
-	// block balance updates last
-	allBalanceUpdates = allBalanceUpdates.Add(preprocessedBlockBalanceUpdates...).Add(cache...)
-
-	return allBalanceUpdates, nil
+	switch ordering {
+	case balanceUpdatesOrderingNode:
+		return allBalanceUpdates.Add(blockBalanceUpdates...), nil
+	case balanceUpdatesOrderingMetadataFirst:
+		return append(PRBalanceUpdates{}, preprocessedBlockBalanceUpdates...).Add(cache...).Add(allBalanceUpdates...), nil
+	default:
+		// block balance updates last
+		return allBalanceUpdates.Add(preprocessedBlockBalanceUpdates...).Add(cache...), nil
+	}
 }
 
 func (engine *rpcCollector) GetDelegationState(ctx context.Context, delegate *rpc.Delegate, cycle int64, lastBlockInTheCycle rpc.BlockID) (*common.DelegationState, error) {
@@ -597,76 +903,39 @@ func (engine *rpcCollector) GetDelegationState(ctx context.Context, delegate *rp
 	if blockLevelWithMinimumBalance == 0 {
 		slog.Debug("fetching delegation state - no minimum, taking last block balances", "blockLevelWithMinimumBalance", lastBlockInTheCycle, "delegate", delegate.Delegate.String())
 		state, err := engine.fetchInitialDelegationState(ctx, delegate, cycle, lastBlockInTheCycle, lastBlockInTheCycle)
-		if err != nil {
+		if state == nil {
 			return nil, err
 		}
-		return state, constants.ErrDelegateHasNoMinimumDelegatedBalance
+		return state, withDelegateStatus(state, delegate, joinStatusErrors(err, constants.ErrDelegateHasNoMinimumDelegatedBalance))
 	}
 
 	slog.Debug("fetching delegation state", "blockLevelWithMinimumBalance", blockLevelWithMinimumBalance, "delegate", delegate.Delegate.String())
-	state, err := engine.fetchInitialDelegationState(ctx, delegate, cycle, lastBlockInTheCycle, blockLevelWithMinimumBalance)
-	if err != nil {
-		return nil, err
+	state, statusErr := engine.fetchInitialDelegationState(ctx, delegate, cycle, lastBlockInTheCycle, blockLevelWithMinimumBalance)
+	if state == nil {
+		return nil, statusErr
 	}
 
 	// we may match at the beginning of the block, we do not have to further process
-	if abs(state.GetDelegatedBalance()-targetAmount) <= constants.MINIMUM_DIFF_TOLERANCE {
-		state.CreatedAt = common.DelegationStateCreationInfo{
-			Level: blockLevelWithMinimumBalance.Int64(),
-			Kind:  common.CreatedAtBlockBeginning,
-		}
-		return state, nil
+	if createdAt, result, found := findMinimum(state, nil, blockLevelWithMinimumBalance, targetAmount, engine.minimumSearch.tolerance); found {
+		createdAt.Strategy = common.MinimumSearchStrategyExact
+		result.CreatedAt = createdAt
+		return result, withDelegateStatus(result, delegate, statusErr)
 	}
 
-	allBalanceUpdates, err := engine.getBlockBalanceUpdates(ctx, state, blockLevelWithMinimumBalance)
+	result, err := engine.searchMinimum(ctx, state, blockLevelWithMinimumBalance, targetAmount)
 	if err != nil {
 		return nil, err
 	}
+	return result, withDelegateStatus(result, delegate, statusErr)
+}
 
-	found := false
-	for _, balanceUpdate := range allBalanceUpdates {
-		if !state.HasContractBalanceInfo(balanceUpdate.Address) {
-			continue
-		}
-
-		if constants.IgnoredBalanceUpdateKinds.Contains(balanceUpdate.Kind) {
-			continue
-		}
-
-		switch balanceUpdate.Source {
-		case common.CreatedOnDelegation:
-			state.Delegate(balanceUpdate.Address, balanceUpdate.Delegate)
-		default:
-			switch {
-			case balanceUpdate.Kind == "staking":
-				// ignore -> staking balance is determined based on the last block of the cycle, we do not care about the intermediate values
-			case balanceUpdate.Kind == "freezer" && balanceUpdate.Category == "deposits":
-				// we ignore deposits because only staked balance at the last block of the cycle is important
-				//state.UpdateBalance(balanceUpdate.Address, "frozen_deposits", balanceUpdate.Amount)
-			case balanceUpdate.Kind == "freezer" && balanceUpdate.Category == "unstaked_deposits":
-				state.UpdateBalance(balanceUpdate.Address, "unfrozen_deposits", balanceUpdate.Amount)
-			default:
-				state.UpdateBalance(balanceUpdate.Address, "", balanceUpdate.Amount)
-			}
-		}
-
-		slog.Debug("balance update", "delegate", balanceUpdate.Delegate, "address", balanceUpdate.Address.String(), "delegated_balance", state.GetDelegatedBalance(), "amount", balanceUpdate.Amount, "target_amount", targetAmount, "diff", state.GetDelegatedBalance()-targetAmount)
-
-		if abs(state.GetDelegatedBalance()-targetAmount) <= constants.MINIMUM_DIFF_TOLERANCE {
-			found = true
-			state.CreatedAt = common.DelegationStateCreationInfo{
-				Level:         blockLevelWithMinimumBalance.Int64(),
-				Operation:     balanceUpdate.Operation,
-				Index:         balanceUpdate.Index,
-				InternalIndex: balanceUpdate.InternalIndex,
-				Kind:          balanceUpdate.Source,
-			}
-			break
-		}
+// adds the status errors derived from the delegate and the final state
+func withDelegateStatus(state *common.DelegationState, delegate *rpc.Delegate, err error) error {
+	if delegate.Deactivated {
+		err = joinStatusErrors(err, constants.ErrDelegateDeactivated)
 	}
-
-	if !found {
-		return nil, constants.ErrMinimumDelegatedBalanceNotFound
+	if len(state.GetDelegatorAndBakerBalances()) == 0 {
+		err = joinStatusErrors(err, constants.ErrDelegateHasZeroBalance)
 	}
-	return state, nil
+	return err
 }
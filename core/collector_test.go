@@ -2,13 +2,16 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"sync"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
 	"github.com/tez-capital/protocol-rewards/constants"
 	"github.com/tez-capital/protocol-rewards/test"
 	"github.com/trilitech/tzgo/rpc"
@@ -27,6 +30,12 @@ func getTransport(path string) *test.TestTransport {
 	return transport
 }
 
+// status errors reported along with a complete state
+func isCompleteStateStatus(err error) bool {
+	_, ok := delegationStateStatusFromError(err)
+	return ok && !errors.Is(err, constants.ErrFailedToFetchContractBalances)
+}
+
 func TestGetActiveDelegates(t *testing.T) {
 	assert := assert.New(t)
 
@@ -61,7 +70,7 @@ func TestGetDelegationStateNoStaking(t *testing.T) {
 		}
 
 		_, err = collector.GetDelegationState(defaultCtx, delegate, cycle, lastBlockInTheCycle)
-		if err != nil && err != constants.ErrDelegateHasNoMinimumDelegatedBalance {
+		if err != nil && !isCompleteStateStatus(err) {
 			assert.Nil(err)
 			return true
 		}
@@ -86,7 +95,7 @@ func TestGetDelegationStateNoStaking(t *testing.T) {
 		}
 
 		_, err = collector.GetDelegationState(defaultCtx, delegate, cycle, lastBlockInTheCycle)
-		if err != nil && err != constants.ErrDelegateHasNoMinimumDelegatedBalance {
+		if err != nil && !isCompleteStateStatus(err) {
 			assert.Nil(err)
 			return true
 		}
@@ -116,7 +125,7 @@ func TestGetDelegationState(t *testing.T) {
 		}
 
 		_, err = collector.GetDelegationState(defaultCtx, delegate, cycle, lastBlockInTheCycle)
-		if err != nil && err != constants.ErrDelegateHasNoMinimumDelegatedBalance {
+		if err != nil && !isCompleteStateStatus(err) {
 			assert.Nil(err)
 			return true
 		}
@@ -125,6 +134,57 @@ func TestGetDelegationState(t *testing.T) {
 	assert.Nil(err)
 }
 
+// recorded block with internal operations of smart contracts, see test/data/kt1
+func TestGetBlockBalanceUpdatesContracts(t *testing.T) {
+	assert := assert.New(t)
+
+	collector, err := newRpcCollector(defaultCtx, []string{"https://eu.rpc.tez.capital/"}, nil, getTransport("../test/data/kt1"))
+	assert.Nil(err)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	recipient := tezos.MustParseAddress("tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc")
+	// delegated to the baker, calls the other contracts
+	wallet := tezos.MustParseAddress("KT1PHubm9HtyQEJ4BBpMTVomq6mhbfNZ9z5w")
+	// delegated to other baker at the beginning of the block, sets the baker as delegate
+	vault := tezos.MustParseAddress("KT19B8uSfiQ8Cxk99ELc7MPccQ9ihyy7jhDU")
+	// originated by the wallet with the baker as delegate
+	child := tezos.MustParseAddress("KT1V5XKmeypanMS9pR65REpqmVejWBZURuuT")
+	applied := tezos.MustParseOpHash("oouYBeBS3nyxkg56dKh2nekaBSdZpPumGLzou9fQ3ov6Fvstzn7")
+	backtracked := tezos.MustParseOpHash("opEe4RPhK6TeX21R8iSt4GuiqNKf1b72zC2VVrvgu3gqk6p7kNh")
+
+	state := common.NewDelegationState(&rpc.Delegate{Delegate: baker}, 749, rpc.BlockLevel(5898240))
+	state.Parameters = &common.StakingParameters{}
+	state.AddBalance(baker, common.DelegationStateBalanceInfo{Balance: common.NewMutez(10_000_000_000), Baker: baker, StakeBaker: baker})
+	state.AddBalance(wallet, common.DelegationStateBalanceInfo{Balance: common.NewMutez(1_000_000_000), Baker: baker, StakeBaker: baker})
+
+	updates, err := collector.getBlockBalanceUpdates(defaultCtx, state, rpc.BlockLevel(5880989), balanceUpdatesOrderingDefault)
+	assert.Nil(err)
+
+	assert.Equal([]PRBalanceUpdate{
+		{Address: vault, Operation: applied, InternalIndex: 1, Source: common.CreatedOnDelegation, Delegate: baker},
+		{Address: child, Operation: applied, InternalIndex: 2, Source: common.CreatedOnDelegation, Delegate: baker},
+	}, lo.Filter(updates, func(update PRBalanceUpdate, _ int) bool { return update.Source == common.CreatedOnDelegation }))
+
+	// only fees of the backtracked operation were applied, neither its top-level transfer and delegation nor internal results
+	assert.Len(lo.Filter(updates, func(update PRBalanceUpdate, _ int) bool {
+		return update.Operation == backtracked && update.Source != common.CreatedAtTransactionMetadata
+	}), 0)
+	assert.Len(lo.Filter(updates, func(update PRBalanceUpdate, _ int) bool {
+		return update.Operation == backtracked && update.Source == common.CreatedAtTransactionMetadata
+	}), 6)
+
+	for _, update := range updates {
+		applyBalanceUpdate(state, update)
+	}
+	balances := state.GetDelegatorAndBakerBalances()
+	assert.Equal(common.NewMutez(750_000_000), balances[wallet].DelegatedBalance)
+	assert.Equal(common.NewMutez(500_000_000), balances[vault].DelegatedBalance)
+	assert.Equal(common.NewMutez(50_000_000), balances[child].DelegatedBalance)
+	assert.Equal(common.AccountTypeOriginated, balances[vault].AccountType)
+	assert.Equal(common.AccountTypeImplicit, balances[baker].AccountType)
+	assert.NotContains(balances, recipient)
+}
+
 func TestCycle749RaceConditions(t *testing.T) {
 	assert := assert.New(t)
 	debug.SetMaxThreads(1000000)
@@ -152,7 +212,7 @@ func TestCycle749RaceConditions(t *testing.T) {
 		}
 
 		_, err = collector.GetDelegationState(defaultCtx, delegate, cycle, lastBlockInTheCycle)
-		if err != nil && err != constants.ErrDelegateHasNoMinimumDelegatedBalance {
+		if err != nil && !isCompleteStateStatus(err) {
 			fmt.Println(delegate.Delegate.String())
 			assert.Nil(err)
 			return true
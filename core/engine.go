@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/tez-capital/protocol-rewards/configuration"
 	"github.com/tez-capital/protocol-rewards/constants"
 	"github.com/tez-capital/protocol-rewards/notifications"
+	"github.com/tez-capital/protocol-rewards/snapshot"
 	"github.com/tez-capital/protocol-rewards/store"
 	"github.com/trilitech/tzgo/rpc"
 	"github.com/trilitech/tzgo/tezos"
@@ -22,46 +24,96 @@ import (
 
 type Engine struct {
 	ctx         context.Context
+	cancel      context.CancelFunc
+	options     *EngineOptions
 	collector   *rpcCollector
 	store       *store.Store
 	state       *state
 	notificator *notifications.DiscordNotificator
 	delegates   []tezos.Address
 	logger      *slog.Logger
+	scheduler   *scheduler
+	previews    *previewTracker
+
+	finalityVerifyInterval time.Duration
 }
 
 type EngineOptions struct {
 	FetchAutomatically bool
 	Transport          http.RoundTripper
+	// deadline for fetching single delegate state, 0 means no deadline
+	DelegateFetchTimeout time.Duration
+	// deadline for fetching all delegates of a cycle, 0 means no deadline
+	CycleFetchTimeout time.Duration
 }
 
 var (
 	DefaultEngineOptions = &EngineOptions{
-		FetchAutomatically: true,
-		Transport:          nil,
+		FetchAutomatically:   true,
+		Transport:            nil,
+		DelegateFetchTimeout: constants.DELEGATE_FETCH_TIMEOUT_MINUTES * time.Minute,
+		CycleFetchTimeout:    constants.CYCLE_FETCH_TIMEOUT_MINUTES * time.Minute,
 	}
 	TestEngineOptions = &EngineOptions{
 		FetchAutomatically: false,
 	}
 )
 
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func NewEngine(ctx context.Context, config *configuration.Runtime, options *EngineOptions) (*Engine, error) {
 	if options == nil {
 		options = DefaultEngineOptions
 	}
+	ctx, cancel := context.WithCancel(ctx)
 
-	collector, err := newRpcCollector(ctx, config.Providers, config.TzktProviders, options.Transport)
+	store, err := store.NewStore(config)
 	if err != nil {
-		slog.Error("failed to create new RPC Collector", "error", err)
+		slog.Error("failed to create new store", "error", err)
+		cancel()
 		return nil, err
 	}
 
-	store, err := store.NewStore(config)
+	if config.Offline {
+		slog.Info("running offline, only stored and imported delegation states are served")
+		result := &Engine{
+			ctx:       ctx,
+			cancel:    cancel,
+			options:   options,
+			store:     store,
+			state:     newState(),
+			previews:  newPreviewTracker(),
+			delegates: config.Delegates,
+			logger:    slog.Default(),
+		}
+		go result.materializeMissingNetworkStatistics()
+		return result, nil
+	}
+
+	collector, err := newRpcCollector(ctx, config.Providers, config.TzktProviders, options.Transport)
 	if err != nil {
-		slog.Error("failed to create new store", "error", err)
+		slog.Error("failed to create new RPC Collector", "error", err)
+		cancel()
 		return nil, err
 	}
 
+	collector.minimumSearch = newMinimumSearchOptions(&config.MinimumSearch)
+	if config.Finality.Confirmations != nil {
+		collector.confirmations = *config.Finality.Confirmations
+	}
+
+	var indexer *unstakeIndexer
+	if len(config.TzktProviders) == 0 {
+		slog.Info("no tzkt provider configured, unstake requests are going to be indexed from blocks")
+		indexer = newUnstakeIndexer(collector, store, config.UnstakeIndexer.StartLevel)
+		collector.indexer = indexer
+	}
+
 	notificator, err := notifications.InitDiscordNotificator(&config.DiscordNotificator)
 	if err != nil {
 		slog.Warn("failed to initialize notificator", "error", err)
@@ -69,71 +121,183 @@ func NewEngine(ctx context.Context, config *configuration.Runtime, options *Engi
 
 	result := &Engine{
 		ctx:         ctx,
+		cancel:      cancel,
+		options:     options,
 		collector:   collector,
 		store:       store,
 		state:       newState(),
+		previews:    newPreviewTracker(),
 		notificator: notificator,
 		delegates:   config.Delegates,
 		logger:      slog.Default(), // TODO: replace with custom logger
+
+		finalityVerifyInterval: time.Duration(config.Finality.VerifyIntervalMinutes) * time.Minute,
 	}
+	go result.materializeMissingNetworkStatistics()
 
 	if options.FetchAutomatically {
-		go result.fetchAutomatically()
+		result.scheduler = newScheduler(result)
+		go result.scheduler.Run(ctx)
+		go result.refreshPreviewsAutomatically()
+		go result.retryFailedDelegatesAutomatically()
+		go result.verifyFinalityAutomatically()
+		if indexer != nil {
+			go indexer.Run(ctx)
+		}
 	}
 
 	return result, nil
 }
 
+// maps status errors returned along with a state, the most severe one wins
+func delegationStateStatusFromError(err error) (common.DelegationStateStatus, bool) {
+	switch {
+	case err == nil:
+		return common.DelegationStateStatusOk, true
+	case errors.Is(err, constants.ErrDelegateNotRegistered):
+		return common.DelegationStateStatusNotRegistered, true
+	case errors.Is(err, constants.ErrFailedToFetchContractBalances):
+		return common.DelegationStateStatusPartial, true
+	case errors.Is(err, constants.ErrDelegateDeactivated):
+		return common.DelegationStateStatusDeactivated, true
+	case errors.Is(err, constants.ErrDelegateHasNoMinimumDelegatedBalance):
+		return common.DelegationStateStatusMinimumNotAvailable, true
+	case errors.Is(err, constants.ErrDelegateHasZeroBalance):
+		return common.DelegationStateStatusZeroBalance, true
+	default:
+		return common.DelegationStateStatusOk, false
+	}
+}
+
+// states with a status error are kept with the status and its reason instead of failing
+func toStoredDelegationState(state *common.DelegationState, err error) (*common.StoredDelegationState, error) {
+	status, ok := delegationStateStatusFromError(err)
+	if state == nil || !ok {
+		return nil, err
+	}
+
+	result := common.CreateStoredDelegationStateFromDelegationState(state)
+	result.Status = status
+	if err != nil {
+		result.StatusReason = strings.ReplaceAll(err.Error(), "\n", "; ")
+	}
+	if status == common.DelegationStateStatusOk && state.CreatedAt.Strategy == common.MinimumSearchStrategyClosestMatch {
+		result.Status = common.DelegationStateStatusMinimumApproximated
+	}
+	return result, nil
+}
+
+// placeholder state of an address which is not a delegate, stored so it is not fetched again
+func newNotRegisteredDelegationState(address tezos.Address, cycle int64, lastBlockInTheCycle rpc.BlockID) *common.DelegationState {
+	state := common.NewDelegationState(&rpc.Delegate{Delegate: address}, cycle, lastBlockInTheCycle)
+	state.Parameters = &common.StakingParameters{}
+	return state
+}
+
 func (e *Engine) fetchDelegateDelegationStateInternal(ctx context.Context, delegateAddress tezos.Address, cycle, lastBlockInTheCycle int64, options *FetchOptions) error {
 	if options == nil {
 		options = &defaultFetchOptions
 	}
 
-	lastBlockInTheCycleId := rpc.BlockLevel(lastBlockInTheCycle)
-
 	if !options.Force && e.state.IsDelegateBeingFetched(cycle, delegateAddress) {
 		e.logger.Debug("delegate delegation state is already being fetched", "cycle", cycle, "delegate", delegateAddress.String())
 		return nil
 	}
 
+	reason := common.DelegationStateVersionReasonForceRefetch
 	if !options.Force {
-		_, err := e.store.GetDelegationState(delegateAddress, cycle)
-		if err == nil { // already fetched
+		reason = common.DelegationStateVersionReasonFetch
+		stored, err := e.store.GetDelegationState(delegateAddress, cycle)
+		switch {
+		case err == nil && stored.Status == common.DelegationStateStatusPartial: // partial states are refetched
+			reason = common.DelegationStateVersionReasonPartialRefetch
+		case err == nil: // already fetched
 			e.logger.Debug("delegate delegation state already fetched", "cycle", cycle, "delegate", delegateAddress.String())
 			return nil
 		}
 	}
 
+	if !e.state.BeginFetch() {
+		return constants.ErrEngineShuttingDown
+	}
+	defer e.state.EndFetch()
+
 	e.logger.Debug("fetching delegate delegation state", "cycle", cycle, "delegate", delegateAddress.String())
 	e.state.AddDelegateBeingFetched(cycle, delegateAddress)
 	defer e.state.RemoveCycleBeingFetched(cycle, delegateAddress)
 
+	ctx, cancel := withOptionalTimeout(ctx, e.options.DelegateFetchTimeout)
+	defer cancel()
+
+	// every fetch is audited with its inputs and outcome
+	ctx, providers := withProviderRecorder(ctx)
+	startedAt := time.Now()
+	state, err := e.fetchAndStoreDelegationState(ctx, delegateAddress, cycle, lastBlockInTheCycle, reason)
+	if err := e.store.RecordFetchAudit(newFetchAudit(delegateAddress, cycle, options, providers.list(), startedAt, state, err)); err != nil {
+		e.logger.Warn("failed to record fetch audit", "cycle", cycle, "delegate", delegateAddress.String(), "error", err.Error())
+	}
+	return err
+}
+
+// the state is returned whenever it was computed, partial states are returned along with an error
+func (e *Engine) fetchAndStoreDelegationState(ctx context.Context, delegateAddress tezos.Address, cycle, lastBlockInTheCycle int64, reason common.DelegationStateVersionReason) (*common.StoredDelegationState, error) {
+	lastBlockInTheCycleId := rpc.BlockLevel(lastBlockInTheCycle)
+
+	var state *common.DelegationState
 	delegate, err := e.collector.GetDelegateFromCycle(ctx, lastBlockInTheCycleId, delegateAddress)
-	if err != nil {
+	switch {
+	case errors.Is(err, constants.ErrDelegateNotRegistered):
+		state = newNotRegisteredDelegationState(delegateAddress, cycle, lastBlockInTheCycleId)
+	case err != nil:
 		e.logger.Debug("failed to get delegate from", "cycle", cycle, "delegateAddress", delegateAddress, "error", err)
-		return err
+		return nil, err
+	default:
+		state, err = e.collector.GetDelegationState(ctx, delegate, cycle, lastBlockInTheCycleId)
+	}
+	storableState, err := toStoredDelegationState(state, err)
+	if err != nil {
+		if errors.Is(err, constants.ErrMinimumDelegatedBalanceNotFound) {
+			e.logger.Error("minimum delegated balance not found by any strategy", "cycle", cycle, "delegate", delegateAddress.String(), "strategies", e.collector.minimumSearch.strategies)
+		}
+		return nil, err
+	}
+	if storableState.Status != common.DelegationStateStatusOk {
+		e.logger.Debug("delegate delegation state is not ok", "cycle", cycle, "delegate", delegateAddress.String(), "status", storableState.Status.QueryStatus(), "reason", storableState.StatusReason)
 	}
 
-	state, err := e.collector.GetDelegationState(ctx, delegate, cycle, lastBlockInTheCycleId)
-	var storableState *store.StoredDelegationState
-	switch {
-	case err != nil && err != constants.ErrDelegateHasNoMinimumDelegatedBalance:
-		if options.Debug && errors.Is(err, constants.ErrMinimumDelegatedBalanceNotFound) {
-			panic(err)
+	// stakers missing from a partial state would be recorded as finalized
+	var stakers []common.StakerLedgerEntry
+	if storableState.Status != common.DelegationStateStatusPartial {
+		stakers, err = e.collector.GetStakerLedger(ctx, state, lastBlockInTheCycleId)
+		if err != nil {
+			e.logger.Debug("failed to get staker ledger", "cycle", cycle, "delegate", delegateAddress.String(), "error", err)
+			return storableState, err
 		}
-		return err
-	case err == constants.ErrDelegateHasNoMinimumDelegatedBalance:
-		storableState = store.CreateStoredDelegationStateFromDelegationState(state)
-		storableState.Status = store.DelegationStateStatusMinimumNotAvailable
-	default:
-		storableState = store.CreateStoredDelegationStateFromDelegationState(state)
 	}
+
+	// recorded so the state can be invalidated if the chain reorganizes
+	lastBlockHash, err := e.collector.getBlockHash(ctx, lastBlockInTheCycleId)
+	if err != nil {
+		e.logger.Debug("failed to get last block hash", "cycle", cycle, "level", lastBlockInTheCycle, "error", err)
+		return storableState, err
+	}
+	storableState.LastBlockLevel = lastBlockInTheCycle
+	storableState.LastBlockHash = lastBlockHash.String()
 	e.logger.Debug("fetched delegate delegation state", "cycle", cycle, "delegate", delegateAddress.String(), "baking_power", state.GetBakingPower())
 
-	return e.store.StoreDelegationState(storableState)
+	if err := e.store.StoreDelegationState(storableState, reason); err != nil {
+		return storableState, err
+	}
+	if storableState.Status == common.DelegationStateStatusPartial {
+		return storableState, errors.Join(constants.ErrFailedToFetchContractBalances, errors.New(storableState.StatusReason))
+	}
+	return storableState, e.store.RecordStakerLedger(cycle, delegateAddress, stakers)
 }
 
 func (e *Engine) FetchDelegateDelegationState(ctx context.Context, delegateAddress tezos.Address, cycle, lastBlockInTheCycle int64, options *FetchOptions) error {
+	if e.IsOffline() {
+		return constants.ErrEngineOffline
+	}
 	e.logger.Info("fetching delegate delegation state", "cycle", cycle, "delegate", delegateAddress.String(), "force_fetch", options)
 	lastCompletedCycle, _, err := e.collector.GetLastCompletedCycle(ctx)
 	if err != nil {
@@ -145,7 +309,7 @@ func (e *Engine) FetchDelegateDelegationState(ctx context.Context, delegateAddre
 	}
 
 	if lastBlockInTheCycle == 0 {
-		lastBlockInTheCycle = e.collector.determineLastBlockOfCycle(cycle)
+		lastBlockInTheCycle = e.collector.determineLastBlockOfCycle(ctx, cycle)
 	}
 
 	if err := e.fetchDelegateDelegationStateInternal(ctx, delegateAddress, cycle, lastBlockInTheCycle, options); err != nil {
@@ -153,6 +317,7 @@ func (e *Engine) FetchDelegateDelegationState(ctx context.Context, delegateAddre
 		return err
 	}
 	e.logger.Info("finished fetching delegate delegation state", "cycle", cycle, "delegate", delegateAddress.String())
+	e.refreshNetworkStatistics(cycle)
 	return nil
 }
 
@@ -175,7 +340,13 @@ func (e *Engine) getDelegates(ctx context.Context, lastBlockInTheCycle int64) ([
 }
 
 func (e *Engine) FetchCycleDelegationStates(ctx context.Context, cycle, lastBlockInTheCycle int64, options *FetchOptions) error {
+	if e.IsOffline() {
+		return constants.ErrEngineOffline
+	}
 	e.logger.Info("fetching cycle delegation states", "cycle", cycle, "options", options)
+	ctx, cancel := withOptionalTimeout(ctx, e.options.CycleFetchTimeout)
+	defer cancel()
+
 	lastCompletedCycle, _, err := e.collector.GetLastCompletedCycle(ctx)
 	if err != nil {
 		e.logger.Error("failed to fetch last completed cycle number", "error", err.Error())
@@ -187,7 +358,7 @@ func (e *Engine) FetchCycleDelegationStates(ctx context.Context, cycle, lastBloc
 	}
 
 	if lastBlockInTheCycle == 0 {
-		lastBlockInTheCycle = e.collector.determineLastBlockOfCycle(cycle)
+		lastBlockInTheCycle = e.collector.determineLastBlockOfCycle(ctx, cycle)
 	}
 
 	delegates, err := e.getDelegates(ctx, lastBlockInTheCycle)
@@ -195,8 +366,40 @@ func (e *Engine) FetchCycleDelegationStates(ctx context.Context, cycle, lastBloc
 		return err
 	}
 
+	if err := e.store.StartCycleFetch(cycle, lastBlockInTheCycle, delegates); err != nil {
+		e.logger.Error("failed to record cycle fetch start", "cycle", cycle, "error", err.Error())
+		return err
+	}
+
+	if options == nil || !options.Force {
+		// resume interrupted fetch, delegates fetched before are skipped
+		fetched, err := e.store.GetSucceededDelegates(cycle)
+		if err != nil {
+			return err
+		}
+		delegates, _ = lo.Difference(delegates, fetched)
+		if len(fetched) > 0 {
+			e.logger.Info("resuming cycle fetch", "cycle", cycle, "already_fetched", len(fetched), "remaining", len(delegates))
+		}
+	}
+
+	// responses of previous cycle are not useful anymore, concurrent cycle fetches keep the cache
+	e.collector.BeginCycleFetch()
+	defer e.collector.EndCycleFetch()
+
+	interrupted := false
 	err = runInParallel(ctx, delegates, constants.DELEGATE_FETCH_BATCH_SIZE, func(ctx context.Context, item tezos.Address, mtx *sync.RWMutex) bool {
 		err := e.fetchDelegateDelegationStateInternal(ctx, item, cycle, lastBlockInTheCycle, options)
+		if errors.Is(err, constants.ErrEngineShuttingDown) || ctx.Err() != nil {
+			// not recorded, the delegate is fetched again when the cycle fetch resumes
+			mtx.Lock()
+			interrupted = true
+			mtx.Unlock()
+			return false
+		}
+		if recordErr := e.store.RecordDelegateFetch(cycle, item, err); recordErr != nil {
+			e.logger.Error("failed to record delegate fetch", "cycle", cycle, "delegate", item.String(), "error", recordErr.Error())
+		}
 		if err != nil {
 			e.logger.Error("failed to fetch delegate delegation state", "cycle", cycle, "delegate", item.String(), "error", err.Error())
 			msg := fmt.Sprintf("Failed to fetch delegate %s delegation state on cycle %d", item.String(), cycle)
@@ -207,87 +410,428 @@ func (e *Engine) FetchCycleDelegationStates(ctx context.Context, cycle, lastBloc
 		return false
 	})
 
+	if err == nil {
+		err = ctx.Err() // cancelled or deadline exceeded, some delegates were not processed
+	}
+	if err == nil && interrupted {
+		err = constants.ErrEngineShuttingDown
+	}
 	if err != nil {
 		e.logger.Error("failed to fetch cycle", "cycle", cycle, "error", err.Error())
 		return err
 	}
+	if err := e.store.FinishCycleFetch(cycle); err != nil {
+		e.logger.Error("failed to record cycle fetch finish", "cycle", cycle, "error", err.Error())
+	}
 	e.logger.Info("finished fetching cycle delegation states", "cycle", cycle)
+	e.refreshNetworkStatistics(cycle)
 	notifications.Notify(e.notificator, fmt.Sprintf("Finished fetching cycle %d delegation states", cycle))
 	return nil
 }
 
+// context of the engine, it is cancelled on shutdown
+func (e *Engine) Context() context.Context {
+	return e.ctx
+}
+
+func (e *Engine) Health() common.EngineHealth {
+	result := common.EngineHealth{
+		Status:           "ok",
+		ShuttingDown:     e.state.IsShuttingDown(),
+		RunningFetches:   e.state.GetRunningFetches(),
+		LastFetchedCycle: e.state.GetLastFetchedCycle(),
+		Offline:          e.IsOffline(),
+	}
+	if e.scheduler != nil {
+		status := e.scheduler.Status()
+		result.Scheduler = &status
+	}
+	if result.ShuttingDown {
+		result.Status = "shutting_down"
+	}
+	return result
+}
+
+// stops scheduling new delegate fetches and waits for the running ones to finish,
+// fetches still running after the timeout are cancelled and resumed on the next start
+func (e *Engine) Shutdown(timeout time.Duration) error {
+	e.state.BeginShutdown()
+	e.logger.Info("shutting down engine", "running_fetches", e.state.GetRunningFetches(), "timeout", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	select {
+	case <-e.state.FetchesDone():
+	case <-ctx.Done():
+	}
+
+	running := e.state.GetRunningFetches()
+	e.cancel()
+	if running > 0 {
+		e.logger.Warn("engine shutdown timed out, cancelling running fetches", "running_fetches", running)
+		return constants.ErrShutdownTimeout
+	}
+	e.logger.Info("engine shut down")
+	return nil
+}
+
+func (e *Engine) IsOffline() bool {
+	return e.collector == nil
+}
+
+// offline the consensus rights delay comes from the last imported snapshot
+func (e *Engine) getCycleBakingPowerOrigin(ctx context.Context, cycle int64) int64 {
+	if !e.IsOffline() {
+		return e.collector.GetCycleBakingPowerOrigin(ctx, cycle)
+	}
+
+	consensusDelay := int64(constants.DEFAULT_CONSENSUS_RIGHTS_DELAY)
+	if record, err := e.store.GetLastSnapshotImport(); err == nil {
+		consensusDelay = record.ConsensusRightsDelay
+	} else if !errors.Is(err, constants.ErrNotFound) {
+		e.logger.Warn("failed to load last snapshot import, using default consensus rights delay", "error", err.Error())
+	}
+	return cycle - 1 - consensusDelay
+}
+
 func (e *Engine) IsDelegateBeingFetched(cycle int64, delegate tezos.Address) bool {
 	return e.state.IsDelegateBeingFetched(cycle, delegate)
 }
 
-func (e *Engine) GetDelegationState(ctx context.Context, delegate tezos.Address, cycle int64) (*store.StoredDelegationState, error) {
-	cycle = e.collector.GetCycleBakingPowerOrigin(ctx, cycle)
+func (e *Engine) GetDelegationState(ctx context.Context, delegate tezos.Address, cycle int64) (*common.StoredDelegationState, error) {
+	cycle = e.getCycleBakingPowerOrigin(ctx, cycle)
 	return e.store.GetDelegationState(delegate, cycle)
 }
 
+// stored version of the state, older versions are kept when the state is recomputed
+func (e *Engine) GetDelegationStateVersion(ctx context.Context, delegate tezos.Address, cycle, version int64) (*common.StoredDelegationState, error) {
+	cycle = e.getCycleBakingPowerOrigin(ctx, cycle)
+	return e.store.GetDelegationStateVersion(delegate, cycle, version)
+}
+
+func (e *Engine) GetDelegationStateVersions(ctx context.Context, delegate tezos.Address, cycle int64) ([]common.DelegationStateVersionInfo, error) {
+	cycle = e.getCycleBakingPowerOrigin(ctx, cycle)
+	return e.store.GetDelegationStateVersions(delegate, cycle)
+}
+
+func (e *Engine) GetDelegationStateVersionDiff(ctx context.Context, delegate tezos.Address, cycle, versionA, versionB int64) (*common.DelegationStateVersionDiff, error) {
+	cycle = e.getCycleBakingPowerOrigin(ctx, cycle)
+	return e.store.GetDelegationStateVersionDiff(delegate, cycle, versionA, versionB)
+}
+
+func (e *Engine) GetDelegationStates(ctx context.Context, delegates []tezos.Address, cycles []int64) ([]common.DelegationStateQueryResult, error) {
+	delegates = lo.Uniq(delegates)
+	cycles = lo.Uniq(cycles)
+
+	originCycles := make(map[int64]int64, len(cycles))
+	for _, cycle := range cycles {
+		originCycles[cycle] = e.getCycleBakingPowerOrigin(ctx, cycle)
+	}
+
+	states, err := e.store.GetDelegationStates(delegates, lo.Uniq(lo.Values(originCycles)))
+	if err != nil {
+		return nil, err
+	}
+
+	type stateKey struct {
+		delegate tezos.Address
+		cycle    int64
+	}
+	statesByKey := make(map[stateKey]*common.StoredDelegationState, len(states))
+	for i := range states {
+		statesByKey[stateKey{states[i].Delegate.Address, states[i].Cycle}] = &states[i]
+	}
+
+	result := make([]common.DelegationStateQueryResult, 0, len(delegates)*len(cycles))
+	for _, cycle := range cycles {
+		for _, delegate := range delegates {
+			entry := common.DelegationStateQueryResult{
+				Delegate: delegate,
+				Cycle:    cycle,
+				Status:   common.DelegationStateQueryStatusOk,
+			}
+
+			state, ok := statesByKey[stateKey{delegate, originCycles[cycle]}]
+			if ok {
+				entry.Status = state.Status.QueryStatus()
+				entry.State = state
+			} else {
+				entry.Status = common.DelegationStateQueryStatusNotFound
+			}
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// from and to are cycles the states are relevant for, they are translated to origin cycles with the same offset as GetDelegationState
+func (e *Engine) GetDelegationStateHistory(ctx context.Context, delegate tezos.Address, fromCycle, toCycle int64) ([]common.DelegationStateHistoryEntry, error) {
+	offset := toCycle - e.getCycleBakingPowerOrigin(ctx, toCycle)
+
+	states, err := e.store.GetDelegationStateHistory(delegate, fromCycle-offset, toCycle-offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(states, func(state common.StoredDelegationState, _ int) common.DelegationStateHistoryEntry {
+		return state.ToHistoryEntry(state.Cycle + offset)
+	}), nil
+}
+
+// maps stored states to the future cycles they govern, starting with the one after the last fetched cycle
+func (e *Engine) GetUpcomingCycles(ctx context.Context, delegate tezos.Address) ([]common.UpcomingCycle, error) {
+	lastFetchedCycle, err := e.store.GetLastFetchedCycle()
+	if err != nil {
+		return nil, err
+	}
+	offset := lastFetchedCycle - e.getCycleBakingPowerOrigin(ctx, lastFetchedCycle)
+
+	states, err := e.store.GetDelegationStateHistory(delegate, lastFetchedCycle-offset+1, lastFetchedCycle)
+	if err != nil {
+		return nil, err
+	}
+
+	cycles := lo.Map(states, func(state common.StoredDelegationState, _ int) int64 { return state.Cycle })
+	statistics, err := e.store.GetNetworkStatisticsOfCycles(cycles)
+	if err != nil {
+		e.logger.Warn("failed to load network statistics, baking power share is not available", "error", err.Error())
+	}
+
+	result := make([]common.UpcomingCycle, 0, len(states))
+	for _, state := range states {
+		var networkBakingPower common.Mutez
+		if cycleStatistics, ok := statistics[state.Cycle]; ok {
+			networkBakingPower = cycleStatistics.TotalBakingPower
+		}
+		result = append(result, state.ToUpcomingCycle(state.Cycle+offset, networkBakingPower))
+	}
+	return result, nil
+}
+
+func (e *Engine) GetStakerLedger(ctx context.Context, staker tezos.Address) (*common.StakerLedger, error) {
+	return e.store.GetStakerLedger(staker)
+}
+
+func (e *Engine) GetDelegationStateDiff(ctx context.Context, delegate tezos.Address, cycleA, cycleB int64) (*common.DelegationStateDiff, error) {
+	originCycleA := e.getCycleBakingPowerOrigin(ctx, cycleA)
+	originCycleB := e.getCycleBakingPowerOrigin(ctx, cycleB)
+
+	diff, err := e.store.GetDelegationStateDiff(delegate, originCycleA, originCycleB)
+	if err != nil {
+		return nil, err
+	}
+	// report cycles the same way they were requested
+	diff.CycleA = cycleA
+	diff.CycleB = cycleB
+	return diff, nil
+}
+
 func (e *Engine) IsDelegationStateAvailable(ctx context.Context, delegate tezos.Address, cycle int64) (bool, error) {
-	cycle = e.collector.GetCycleBakingPowerOrigin(ctx, cycle)
+	cycle = e.getCycleBakingPowerOrigin(ctx, cycle)
 	return e.store.IsDelegationStateAvailable(delegate, cycle)
 }
 
+// signed snapshot of the state relevant for the cycle, together with the data needed to verify it against the chain
+func (e *Engine) ExportSnapshot(ctx context.Context, delegate tezos.Address, cycle int64, key tezos.PrivateKey) (*snapshot.File, error) {
+	if e.IsOffline() {
+		return nil, constants.ErrEngineOffline
+	}
+
+	originCycle := e.getCycleBakingPowerOrigin(ctx, cycle)
+	state, err := e.store.GetDelegationState(delegate, originCycle)
+	if err != nil {
+		return nil, err
+	}
+
+	// prefer the level the state was fetched with, it can not be determined from the cycle on every network
+	lastBlockLevel := state.LastBlockLevel
+	if lastBlockLevel == 0 {
+		lastBlockLevel = e.collector.determineLastBlockOfCycle(ctx, originCycle)
+		if fetch, err := e.store.GetCycleFetch(originCycle); err == nil && fetch.LastBlockLevel > 0 {
+			lastBlockLevel = fetch.LastBlockLevel
+		}
+	}
+	header, err := e.collector.GetBlockHeader(ctx, rpc.BlockLevel(lastBlockLevel))
+	if err != nil {
+		return nil, err
+	}
+	if state.LastBlockHash != "" && state.LastBlockHash != header.Hash.String() {
+		return nil, constants.ErrLastBlockHashMismatch
+	}
+
+	return snapshot.Sign(&snapshot.Payload{
+		Cycle:                cycle,
+		Protocol:             header.Protocol,
+		LastBlockLevel:       header.Level,
+		LastBlockHash:        header.Hash,
+		ConsensusRightsDelay: cycle - 1 - originCycle,
+		ExportedAt:           time.Now().UTC(),
+		State:                *state,
+	}, key)
+}
+
 func (e *Engine) Statisticts(ctx context.Context, cycle int64) (*common.CycleStatistics, error) {
 	return e.store.Statistics(cycle)
 }
 
-func (e *Engine) fetchAutomatically() {
-	go func() {
-		for {
-			select {
-			case <-e.ctx.Done():
-				return
-			default:
-				time.Sleep(constants.CYCLE_FETCH_FREQUENCY_MINUTES * time.Minute)
-
-				lastOnChainCompletedCycle, lastBlockInTheCycle, err := e.collector.GetLastCompletedCycle(e.ctx)
-				if err != nil {
-					e.logger.Error("failed to fetch last completed cycle number", "error", err.Error())
-					return
-				}
-
-				lastFetchedCycle := e.state.GetLastFetchedCycle()
-				if lastFetchedCycle >= lastOnChainCompletedCycle {
-					e.logger.Debug("no new cycle completed", "last_fetched_cycle", lastFetchedCycle, "last_on_chain_completed_cycle", lastOnChainCompletedCycle)
-					continue
-				}
-
-				if lastFetchedCycle == 0 {
-					cycle, _ := e.store.GetLastFetchedCycle()
-					switch cycle {
-					case 0:
-						e.state.SetLastFetchedCycle(lastOnChainCompletedCycle - 1)
-					default:
-						e.state.SetLastFetchedCycle(cycle)
-					}
-					lastFetchedCycle = e.state.GetLastFetchedCycle()
-				}
-
-				if lastFetchedCycle+1 <= lastOnChainCompletedCycle {
-					e.logger.Info("fetching missing delegation states", "last_fetched_cycle", e.state.lastFetchedCycle, "last_on_chain_completed_cycle", lastOnChainCompletedCycle)
-				}
-
-				for cycle := lastFetchedCycle + 1; cycle <= lastOnChainCompletedCycle; cycle++ {
-					// this is not ideal but we can not determine last block on testnets easily
-					// so we try to use available last block level, if not fall back to lookup in cycle table which works on mainnet and networks with known parameters by tzgo
-					lastBlock := int64(0)
-					if cycle == lastOnChainCompletedCycle {
-						lastBlock = lastBlockInTheCycle
-					}
-
-					if err = e.FetchCycleDelegationStates(e.ctx, cycle, lastBlock, nil); err != nil {
-						e.logger.Error("failed to fetch cycle delegation states", "cycle", cycle, "error", err.Error())
-					}
-					if err = e.store.PruneDelegationState(cycle); err != nil {
-						e.logger.Error("failed to prune cycles out", "error", err.Error())
-					}
-				}
-
-				e.state.SetLastFetchedCycle(lastOnChainCompletedCycle)
-			}
+func (e *Engine) GetCycleFetchStatus(ctx context.Context, cycle int64) (*common.CycleFetchStatus, error) {
+	return e.store.GetCycleFetchStatus(cycle)
+}
+
+// refetches delegates which failed during cycle fetch, the store schedules retries with backoff
+func (e *Engine) retryFailedDelegates(ctx context.Context) {
+	toRetry, err := e.store.GetDelegateFetchesToRetry(constants.DELEGATE_RETRY_BATCH_SIZE)
+	if err != nil {
+		e.logger.Error("failed to load delegates to retry", "error", err.Error())
+		return
+	}
+
+	recoveredCycles := make(map[int64]bool)
+	for _, record := range toRetry {
+		if ctx.Err() != nil || e.state.IsShuttingDown() {
+			return
+		}
+		cycle, delegate := record.Cycle, record.Delegate.Address
+
+		// prefer last block recorded by the cycle fetch, it is exact on testnets too
+		lastBlockInTheCycle := int64(0)
+		if cycleFetch, err := e.store.GetCycleFetch(cycle); err == nil {
+			lastBlockInTheCycle = cycleFetch.LastBlockLevel
+		}
+		if lastBlockInTheCycle == 0 {
+			lastBlockInTheCycle = e.collector.determineLastBlockOfCycle(ctx, cycle)
+		}
+
+		e.logger.Info("retrying failed delegate fetch", "cycle", cycle, "delegate", delegate.String(), "attempts", record.Attempts)
+		err := e.fetchDelegateDelegationStateInternal(ctx, delegate, cycle, lastBlockInTheCycle, nil)
+		if errors.Is(err, constants.ErrEngineShuttingDown) || ctx.Err() != nil {
+			return
+		}
+		if recordErr := e.store.RecordDelegateFetch(cycle, delegate, err); recordErr != nil {
+			e.logger.Error("failed to record delegate fetch", "cycle", cycle, "delegate", delegate.String(), "error", recordErr.Error())
+		}
+		if err != nil {
+			e.logger.Warn("retry of delegate fetch failed", "cycle", cycle, "delegate", delegate.String(), "error", err.Error())
+			continue
+		}
+		recoveredCycles[cycle] = true
+	}
+
+	for cycle := range recoveredCycles {
+		e.refreshNetworkStatistics(cycle)
+	}
+}
+
+// statistics are not computed on request, cycles stored without them are materialized once on startup
+func (e *Engine) materializeMissingNetworkStatistics() {
+	cycles, err := e.store.GetCyclesWithoutNetworkStatistics()
+	if err != nil {
+		e.logger.Error("failed to load cycles without network statistics", "error", err.Error())
+		return
+	}
+	for _, cycle := range cycles {
+		if e.ctx.Err() != nil {
+			return
+		}
+		e.logger.Info("materializing missing network statistics", "cycle", cycle)
+		e.refreshNetworkStatistics(cycle)
+	}
+}
+
+// materialized statistics of the cycle and the changes reported by the next one depend on the stored states
+func (e *Engine) refreshNetworkStatistics(cycle int64) {
+	if err := e.store.RefreshChangedNetworkStatistics(cycle); err != nil {
+		e.logger.Error("failed to refresh network statistics", "cycle", cycle, "error", err.Error())
+	}
+}
+
+func (e *Engine) retryFailedDelegatesAutomatically() {
+	for {
+		if err := sleepWithContext(e.ctx, constants.DELEGATE_RETRY_CHECK_INTERVAL_MINUTES*time.Minute); err != nil {
+			return
+		}
+		if e.state.IsShuttingDown() {
+			return
 		}
-	}()
+		e.retryFailedDelegates(e.ctx)
+	}
+}
+
+// recorded last blocks which are no longer part of the canonical chain, each cycle is reported once
+func detectReorganizedCycles(ctx context.Context, recorded []store.CycleLastBlock, getBlockHash func(ctx context.Context, level int64) (tezos.BlockHash, error)) []store.CycleLastBlock {
+	result := make([]store.CycleLastBlock, 0)
+	reported := make(map[int64]bool)
+	for _, block := range recorded {
+		if ctx.Err() != nil {
+			break
+		}
+		if reported[block.Cycle] {
+			continue
+		}
+		canonical, err := getBlockHash(ctx, block.LastBlockLevel)
+		if err != nil {
+			slog.Warn("failed to get canonical block hash", "cycle", block.Cycle, "level", block.LastBlockLevel, "error", err.Error())
+			continue
+		}
+		if canonical.String() == block.LastBlockHash {
+			continue
+		}
+		reported[block.Cycle] = true
+		result = append(result, block)
+	}
+	return result
+}
+
+// re-verifies block hashes recorded with states of recent cycles, states fetched from an orphaned branch are
+// invalidated and fetched again by the scheduler
+func (e *Engine) verifyFinality(ctx context.Context) {
+	lastFetchedCycle := e.state.GetLastFetchedCycle()
+	if lastFetchedCycle == 0 {
+		// scheduler did not run yet
+		lastFetchedCycle, _ = e.store.GetLastFetchedCycle()
+	}
+	recorded, err := e.store.GetRecordedLastBlocks(lastFetchedCycle - constants.STORED_CYCLES)
+	if err != nil {
+		e.logger.Error("failed to load recorded last blocks", "error", err.Error())
+		return
+	}
+
+	reorganized := detectReorganizedCycles(ctx, recorded, func(ctx context.Context, level int64) (tezos.BlockHash, error) {
+		header, err := e.collector.GetBlockHeader(ctx, rpc.BlockLevel(level))
+		if err != nil {
+			return tezos.ZeroBlockHash, err
+		}
+		return header.Hash, nil
+	})
+	for _, block := range reorganized {
+		e.logger.Warn("recorded last block is not canonical anymore, refetching cycle", "cycle", block.Cycle, "level", block.LastBlockLevel, "recorded_hash", block.LastBlockHash)
+		if err := e.store.InvalidateDelegationStates(block.Cycle, block.LastBlockHash); err != nil {
+			e.logger.Error("failed to invalidate delegation states", "cycle", block.Cycle, "error", err.Error())
+		}
+	}
+	if len(reorganized) > 0 && e.scheduler != nil {
+		e.scheduler.notify()
+	}
+}
+
+// verifies on startup and then periodically
+func (e *Engine) verifyFinalityAutomatically() {
+	interval := e.finalityVerifyInterval
+	if interval <= 0 {
+		interval = constants.FINALITY_VERIFY_INTERVAL_MINUTES * time.Minute
+	}
+	for {
+		if e.state.IsShuttingDown() {
+			return
+		}
+		e.verifyFinality(e.ctx)
+		if err := sleepWithContext(e.ctx, interval); err != nil {
+			return
+		}
+	}
+}
+
+// materialized statistics only, they are refreshed whenever stored states change
+func (e *Engine) NetworkStatistics(ctx context.Context, cycle int64) (*common.NetworkCycleStatistics, error) {
+	return e.store.GetNetworkStatistics(cycle)
 }
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/tez-capital/protocol-rewards/store"
+	"github.com/trilitech/tzgo/rpc"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestDetectReorganizedCycles(t *testing.T) {
+	assert := assert.New(t)
+
+	canonical := tezos.MustParseBlockHash("BLockGenesisGenesisGenesisGenesisGenesisf79b5d1CoW2")
+	orphaned := tezos.MustParseBlockHash("BMWVEwEYw9m5iaHzqxDfkPzZTV4rhkSouRh3DkVMVGkxZ3EVaNs")
+
+	recorded := []store.CycleLastBlock{
+		{Cycle: 745, LastBlockLevel: 100, LastBlockHash: canonical.String()},
+		{Cycle: 746, LastBlockLevel: 200, LastBlockHash: orphaned.String()},
+		// partially refetched cycle is reported once
+		{Cycle: 746, LastBlockLevel: 200, LastBlockHash: "BLockGenesisGenesisGenesisGenesisGenesisCCCCCeZiLHU"},
+		// unavailable block is skipped until the next verification
+		{Cycle: 747, LastBlockLevel: 300, LastBlockHash: orphaned.String()},
+	}
+	reorganized := detectReorganizedCycles(context.Background(), recorded, func(ctx context.Context, level int64) (tezos.BlockHash, error) {
+		if level == 300 {
+			return tezos.ZeroBlockHash, errors.New("unavailable")
+		}
+		return canonical, nil
+	})
+	assert.Equal([]store.CycleLastBlock{recorded[1]}, reorganized)
+}
+
+func TestToStoredDelegationStateStatuses(t *testing.T) {
+	assert := assert.New(t)
+
+	newState := func() *common.DelegationState {
+		return newNotRegisteredDelegationState(tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM"), 750, rpc.BlockLevel(100))
+	}
+
+	stored, err := toStoredDelegationState(newState(), nil)
+	assert.Nil(err)
+	assert.Equal(common.DelegationStateStatusOk, stored.Status)
+	assert.Empty(stored.StatusReason)
+
+	approximated := newState()
+	approximated.CreatedAt.Strategy = common.MinimumSearchStrategyClosestMatch
+	stored, _ = toStoredDelegationState(approximated, nil)
+	assert.Equal(common.DelegationStateStatusMinimumApproximated, stored.Status)
+
+	stored, _ = toStoredDelegationState(newState(), constants.ErrDelegateHasNoMinimumDelegatedBalance)
+	assert.Equal(common.DelegationStateStatusMinimumNotAvailable, stored.Status)
+
+	// the most severe status wins, all reasons are kept
+	stored, _ = toStoredDelegationState(newState(), errors.Join(constants.ErrDelegateHasNoMinimumDelegatedBalance, constants.ErrDelegateDeactivated, constants.ErrDelegateHasZeroBalance))
+	assert.Equal(common.DelegationStateStatusDeactivated, stored.Status)
+	assert.Equal("delegate has no minimum delegated balance; delegate is deactivated; delegate has neither delegated nor staked balance", stored.StatusReason)
+
+	stored, _ = toStoredDelegationState(newState(), errors.Join(constants.ErrDelegateDeactivated, errors.Join(constants.ErrFailedToFetchContractBalances, errors.New("1 contracts failed"))))
+	assert.Equal(common.DelegationStateStatusPartial, stored.Status)
+
+	stored, _ = toStoredDelegationState(newState(), errors.Join(constants.ErrDelegateNotRegistered, errors.New("404")))
+	assert.Equal(common.DelegationStateStatusNotRegistered, stored.Status)
+
+	// other errors and missing states fail
+	_, err = toStoredDelegationState(newState(), constants.ErrMinimumDelegatedBalanceNotFound)
+	assert.ErrorIs(err, constants.ErrMinimumDelegatedBalanceNotFound)
+	_, err = toStoredDelegationState(nil, constants.ErrDelegateHasZeroBalance)
+	assert.ErrorIs(err, constants.ErrDelegateHasZeroBalance)
+}
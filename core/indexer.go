@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/tez-capital/protocol-rewards/store"
+	"github.com/trilitech/tzgo/rpc"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+// follows the chain and keeps track of stakers with pending unstake requests,
+// used as unstake requests candidates source when there is no tzkt provider
+type unstakeIndexer struct {
+	collector  *rpcCollector
+	store      *store.Store
+	startLevel int64
+
+	// blocks are indexed either by Run or on demand by GetUnstakeRequestsCandidates, one at a time
+	mtx sync.Mutex
+}
+
+func newUnstakeIndexer(collector *rpcCollector, store *store.Store, startLevel int64) *unstakeIndexer {
+	return &unstakeIndexer{
+		collector:  collector,
+		store:      store,
+		startLevel: startLevel,
+	}
+}
+
+func collectUnstakeChanges(changes []store.UnstakeChange, updates rpc.BalanceUpdates) []store.UnstakeChange {
+	for _, update := range updates {
+		if update.Kind != "freezer" || update.Category != "unstaked_deposits" {
+			continue
+		}
+		// slashing of unstaked deposits is accounted to the baker only, we are interested in stakers
+		if !update.Staker.Contract.IsValid() || !update.Staker.Delegate.IsValid() {
+			continue
+		}
+		changes = append(changes, store.UnstakeChange{
+			Baker:  update.Staker.Delegate,
+			Staker: update.Staker.Contract,
+			Amount: update.Amount(),
+		})
+	}
+	return changes
+}
+
+// unstake (credit) and finalize (debit) of unstaked deposits within the block
+func extractUnstakeChanges(block *rpc.Block) []store.UnstakeChange {
+	changes := make([]store.UnstakeChange, 0)
+	for _, batch := range block.Operations {
+		for _, operation := range batch {
+			for _, content := range operation.Contents {
+				changes = collectUnstakeChanges(changes, content.Result().BalanceUpdates)
+				for _, internalResult := range content.Meta().InternalResults {
+					changes = collectUnstakeChanges(changes, internalResult.Result.BalanceUpdates)
+				}
+			}
+		}
+	}
+	return collectUnstakeChanges(changes, block.Metadata.BalanceUpdates)
+}
+
+func (indexer *unstakeIndexer) getHeadLevel(ctx context.Context) (int64, error) {
+	header, err := attemptWithClients(ctx, indexer.collector.rpcs, func(client *rpc.Client) (*rpc.BlockHeader, error) {
+		return client.GetTipHeader(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return header.Level, nil
+}
+
+func (indexer *unstakeIndexer) getNextLevel(ctx context.Context, headLevel int64) (int64, error) {
+	state, err := indexer.store.GetIndexerState(constants.UNSTAKE_INDEXER_NAME)
+	switch {
+	case err == nil:
+		return state.LastIndexedLevel + 1, nil
+	case !errors.Is(err, constants.ErrNotFound):
+		return 0, err
+	case indexer.startLevel > 0:
+		return indexer.startLevel, nil
+	}
+
+	blocksPerCycle, _ := attemptWithClients(ctx, indexer.collector.rpcs, func(client *rpc.Client) (int64, error) {
+		return client.Params.BlocksPerCycle, nil
+	})
+	startLevel := max(headLevel-constants.UNSTAKE_INDEXER_DEFAULT_START_CYCLES*blocksPerCycle, 1)
+	slog.Warn("unstake indexer start level not configured, unstake requests created before it will not be considered", "start_level", startLevel)
+	return startLevel, nil
+}
+
+func (indexer *unstakeIndexer) fetchBlocks(ctx context.Context, levels []int64) ([]*rpc.Block, error) {
+	blocks := make(map[int64]*rpc.Block, len(levels))
+	var fetchErr error
+	runInParallel(ctx, levels, constants.UNSTAKE_INDEXER_BATCH_SIZE, func(ctx context.Context, level int64, mtx *sync.RWMutex) (cancel bool) {
+		// blocks are not cached, they are visited only once
+		block, err := attemptWithClients(ctx, indexer.collector.rpcs, func(client *rpc.Client) (*rpc.Block, error) {
+			return client.GetBlock(ctx, rpc.BlockLevel(level))
+		})
+		mtx.Lock()
+		defer mtx.Unlock()
+		if err != nil {
+			fetchErr = errors.Join(fetchErr, err)
+			return true
+		}
+		blocks[level] = block
+		return false
+	})
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*rpc.Block, 0, len(levels))
+	for _, level := range levels {
+		block, ok := blocks[level]
+		if !ok {
+			return nil, fmt.Errorf("block %d was not fetched", level)
+		}
+		result = append(result, block)
+	}
+	return result, nil
+}
+
+// indexes blocks up to the target level, never above the head minus finality depth
+func (indexer *unstakeIndexer) indexBlocks(ctx context.Context, targetLevel int64) error {
+	indexer.mtx.Lock()
+	defer indexer.mtx.Unlock()
+
+	headLevel, err := indexer.getHeadLevel(ctx)
+	if err != nil {
+		return err
+	}
+	targetLevel = min(targetLevel, headLevel-constants.UNSTAKE_INDEXER_FINALITY_DEPTH)
+
+	nextLevel, err := indexer.getNextLevel(ctx, headLevel)
+	if err != nil {
+		return err
+	}
+
+	for nextLevel <= targetLevel {
+		levels := lo.RangeFrom(nextLevel, int(min(targetLevel-nextLevel+1, constants.UNSTAKE_INDEXER_BATCH_SIZE)))
+		blocks, err := indexer.fetchBlocks(ctx, levels)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			changes := extractUnstakeChanges(block)
+			if err := indexer.store.ApplyUnstakeChanges(constants.UNSTAKE_INDEXER_NAME, block.GetLevel(), changes); err != nil {
+				return err
+			}
+		}
+		nextLevel += int64(len(levels))
+		slog.Debug("indexed unstake requests", "level", nextLevel-1, "target_level", targetLevel)
+	}
+	return nil
+}
+
+func (indexer *unstakeIndexer) indexAvailableBlocks(ctx context.Context) error {
+	return indexer.indexBlocks(ctx, math.MaxInt64)
+}
+
+func (indexer *unstakeIndexer) Run(ctx context.Context) {
+	slog.Info("starting unstake indexer")
+	for {
+		if err := indexer.indexAvailableBlocks(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("failed to index unstake requests", "error", err.Error())
+		}
+		if err := sleepWithContext(ctx, constants.UNSTAKE_INDEXER_POLL_INTERVAL_SECONDS*time.Second); err != nil {
+			return
+		}
+	}
+}
+
+// without automatic fetching the indexer is not running, it catches up to the requested level first
+func (indexer *unstakeIndexer) GetUnstakeRequestsCandidates(ctx context.Context, delegate tezos.Address, blockLevel int64) ([]tezos.Address, error) {
+	state, err := indexer.store.GetIndexerState(constants.UNSTAKE_INDEXER_NAME)
+	if err != nil && !errors.Is(err, constants.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil || blockLevel > state.LastIndexedLevel {
+		if err := indexer.indexBlocks(ctx, blockLevel); err != nil {
+			return nil, errors.Join(constants.ErrUnstakeIndexerBehind, err)
+		}
+		if state, err = indexer.store.GetIndexerState(constants.UNSTAKE_INDEXER_NAME); err != nil {
+			return nil, errors.Join(constants.ErrUnstakeIndexerBehind, err)
+		}
+	}
+	if blockLevel < state.FirstIndexedLevel || blockLevel > state.LastIndexedLevel {
+		return nil, constants.ErrUnstakeIndexerBehind
+	}
+
+	return indexer.store.GetUnstakeCandidates(delegate, blockLevel)
+}
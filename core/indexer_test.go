@@ -0,0 +1,63 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/store"
+	"github.com/trilitech/tzgo/rpc"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+const unstakeBlock = `{
+	"header": { "level": 100 },
+	"metadata": {
+		"balance_updates": [
+			{ "kind": "freezer", "category": "unstaked_deposits", "staker": { "delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" }, "cycle": 10, "change": "-5", "origin": "block" },
+			{ "kind": "freezer", "category": "deposits", "staker": { "baker_own_stake": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" }, "change": "5", "origin": "block" }
+		]
+	},
+	"operations": [[], [], [], [
+		{
+			"contents": [
+				{
+					"kind": "transaction",
+					"source": "tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3",
+					"destination": "tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3",
+					"amount": "1000",
+					"metadata": {
+						"balance_updates": [],
+						"operation_result": {
+							"status": "applied",
+							"balance_updates": [
+								{ "kind": "freezer", "category": "deposits", "staker": { "contract": "tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3", "delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" }, "change": "-1000", "origin": "block" },
+								{ "kind": "freezer", "category": "unstaked_deposits", "staker": { "contract": "tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3", "delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" }, "cycle": 10, "change": "1000", "origin": "block" },
+								{ "kind": "freezer", "category": "unstaked_deposits", "staker": { "contract": "tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc", "delegate": "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx" }, "cycle": 4, "change": "-300", "origin": "block" },
+								{ "kind": "contract", "contract": "tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc", "change": "300", "origin": "block" }
+							]
+						}
+					}
+				}
+			]
+		}
+	]]
+}`
+
+func TestExtractUnstakeChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	// tzgo expects compact operations as returned by the node
+	var compacted bytes.Buffer
+	assert.Nil(json.Compact(&compacted, []byte(unstakeBlock)))
+	var block rpc.Block
+	assert.Nil(json.Unmarshal(compacted.Bytes(), &block))
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	changes := extractUnstakeChanges(&block)
+	assert.Equal([]store.UnstakeChange{
+		{Baker: baker, Staker: tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3"), Amount: 1000},
+		{Baker: baker, Staker: tezos.MustParseAddress("tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc"), Amount: -300},
+	}, changes)
+}
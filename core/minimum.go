@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/configuration"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/rpc"
+)
+
+type balanceUpdatesOrdering int
+
+const (
+	// operations first, burns and stakes last within operation, block metadata last
+	balanceUpdatesOrderingDefault balanceUpdatesOrdering = iota
+	// as reported by the node
+	balanceUpdatesOrderingNode
+	// block metadata first, then operations
+	balanceUpdatesOrderingMetadataFirst
+)
+
+type minimumSearchStrategyDefinition struct {
+	ordering balanceUpdatesOrdering
+	// accept the closest balance instead of the one within tolerance
+	closest bool
+}
+
+var minimumSearchStrategies = map[common.MinimumSearchStrategy]minimumSearchStrategyDefinition{
+	common.MinimumSearchStrategyExact:         {ordering: balanceUpdatesOrderingDefault},
+	common.MinimumSearchStrategyNodeOrder:     {ordering: balanceUpdatesOrderingNode},
+	common.MinimumSearchStrategyMetadataFirst: {ordering: balanceUpdatesOrderingMetadataFirst},
+	common.MinimumSearchStrategyClosestMatch:  {ordering: balanceUpdatesOrderingDefault, closest: true},
+}
+
+var defaultMinimumSearchStrategies = []common.MinimumSearchStrategy{
+	common.MinimumSearchStrategyExact,
+	common.MinimumSearchStrategyNodeOrder,
+	common.MinimumSearchStrategyMetadataFirst,
+	common.MinimumSearchStrategyClosestMatch,
+}
+
+type minimumSearchOptions struct {
+	tolerance common.Mutez
+	// 0 means the closest match is always accepted
+	maxResidual common.Mutez
+	strategies  []common.MinimumSearchStrategy
+}
+
+func newMinimumSearchOptions(config *configuration.MinimumSearchConfiguration) *minimumSearchOptions {
+	result := &minimumSearchOptions{
+		tolerance:  common.NewMutez(constants.MINIMUM_DIFF_TOLERANCE),
+		strategies: defaultMinimumSearchStrategies,
+	}
+	if config == nil {
+		return result
+	}
+
+	if config.Tolerance != nil {
+		result.tolerance = common.NewMutez(*config.Tolerance).Abs()
+	}
+	result.maxResidual = common.NewMutez(config.MaxResidual).Abs()
+
+	if len(config.Strategies) > 0 {
+		strategies := make([]common.MinimumSearchStrategy, 0, len(config.Strategies))
+		for _, name := range config.Strategies {
+			strategy := common.MinimumSearchStrategy(name)
+			if _, ok := minimumSearchStrategies[strategy]; !ok {
+				slog.Warn("unknown minimum search strategy, skipping", "strategy", name)
+				continue
+			}
+			strategies = append(strategies, strategy)
+		}
+		if len(strategies) > 0 {
+			result.strategies = strategies
+		}
+	}
+	return result
+}
+
+// applies the balance update to the state, returns false if the update is not relevant for the state
+func applyBalanceUpdate(state *common.DelegationState, balanceUpdate PRBalanceUpdate) bool {
+	if !state.HasContractBalanceInfo(balanceUpdate.Address) {
+		return false
+	}
+
+	if constants.IgnoredBalanceUpdateKinds.Contains(balanceUpdate.Kind) {
+		return false
+	}
+
+	switch balanceUpdate.Source {
+	case common.CreatedOnDelegation:
+		state.Delegate(balanceUpdate.Address, balanceUpdate.Delegate)
+	default:
+		switch {
+		case balanceUpdate.Kind == "staking":
+			// ignore -> staking balance is determined based on the last block of the cycle, we do not care about the intermediate values
+		case balanceUpdate.Kind == "freezer" && balanceUpdate.Category == "deposits":
+			// we ignore deposits because only staked balance at the last block of the cycle is important
+			//state.UpdateBalance(balanceUpdate.Address, "frozen_deposits", balanceUpdate.Amount)
+		case balanceUpdate.Kind == "freezer" && balanceUpdate.Category == "unstaked_deposits":
+			state.UpdateBalance(balanceUpdate.Address, "unfrozen_deposits", balanceUpdate.Amount)
+		default:
+			state.UpdateBalance(balanceUpdate.Address, "", balanceUpdate.Amount)
+		}
+	}
+	return true
+}
+
+func newCreationInfo(level rpc.BlockLevel, balanceUpdate PRBalanceUpdate, residual common.Mutez) common.DelegationStateCreationInfo {
+	return common.DelegationStateCreationInfo{
+		Level:         level.Int64(),
+		Operation:     balanceUpdate.Operation,
+		Index:         balanceUpdate.Index,
+		InternalIndex: balanceUpdate.InternalIndex,
+		Kind:          balanceUpdate.Source,
+		Residual:      residual,
+	}
+}
+
+func newBlockBeginningCreationInfo(level rpc.BlockLevel, residual common.Mutez) common.DelegationStateCreationInfo {
+	return common.DelegationStateCreationInfo{
+		Level:    level.Int64(),
+		Kind:     common.CreatedAtBlockBeginning,
+		Residual: residual,
+	}
+}
+
+// findMinimum replays the updates on a copy of the initial state until the delegated balance is within tolerance of the target.
+// It neither fetches anything nor modifies the initial state, the strategy of the returned creation info is left to the caller.
+func findMinimum(initial *common.DelegationState, updates PRBalanceUpdates, level rpc.BlockLevel, targetAmount int64, tolerance common.Mutez) (common.DelegationStateCreationInfo, *common.DelegationState, bool) {
+	state := initial.Clone()
+	residual := state.GetDelegatedBalance().Sub64(targetAmount)
+	if residual.Abs().Cmp(tolerance) <= 0 {
+		return newBlockBeginningCreationInfo(level, residual), state, true
+	}
+
+	for _, balanceUpdate := range updates {
+		if !applyBalanceUpdate(state, balanceUpdate) {
+			continue
+		}
+
+		residual = state.GetDelegatedBalance().Sub64(targetAmount)
+		slog.Debug("balance update", "delegate", balanceUpdate.Delegate, "address", balanceUpdate.Address.String(), "delegated_balance", state.GetDelegatedBalance(), "amount", balanceUpdate.Amount, "target_amount", targetAmount, "diff", residual)
+
+		if residual.Abs().Cmp(tolerance) <= 0 {
+			return newCreationInfo(level, balanceUpdate, residual), state, true
+		}
+	}
+	return common.DelegationStateCreationInfo{}, nil, false
+}
+
+// findClosestMinimum replays all updates on a copy of the initial state and stops at the point where the delegated balance is closest to the target.
+// Earlier points win ties. Matches with residual above maxResidual are rejected unless maxResidual is zero.
+func findClosestMinimum(initial *common.DelegationState, updates PRBalanceUpdates, level rpc.BlockLevel, targetAmount int64, maxResidual common.Mutez) (common.DelegationStateCreationInfo, *common.DelegationState, bool) {
+	replay := initial.Clone()
+	bestIndex := -1 // block beginning
+	bestResidual := replay.GetDelegatedBalance().Sub64(targetAmount)
+	for i, balanceUpdate := range updates {
+		if !applyBalanceUpdate(replay, balanceUpdate) {
+			continue
+		}
+		residual := replay.GetDelegatedBalance().Sub64(targetAmount)
+		if residual.Abs().IsLess(bestResidual.Abs()) {
+			bestIndex = i
+			bestResidual = residual
+		}
+	}
+
+	if !maxResidual.IsZero() && maxResidual.IsLess(bestResidual.Abs()) {
+		slog.Debug("closest match exceeds maximum residual", "delegate", initial.Baker.String(), "residual", bestResidual, "max_residual", maxResidual)
+		return common.DelegationStateCreationInfo{}, nil, false
+	}
+
+	state := initial.Clone()
+	if bestIndex < 0 {
+		return newBlockBeginningCreationInfo(level, bestResidual), state, true
+	}
+	for _, balanceUpdate := range updates[:bestIndex+1] {
+		applyBalanceUpdate(state, balanceUpdate)
+	}
+	return newCreationInfo(level, updates[bestIndex], bestResidual), state, true
+}
+
+// tries configured strategies in order, each of them replays the balance updates on a fresh copy of the state
+func (engine *rpcCollector) searchMinimum(ctx context.Context, state *common.DelegationState, level rpc.BlockLevel, targetAmount int64) (*common.DelegationState, error) {
+	updatesByOrdering := make(map[balanceUpdatesOrdering]PRBalanceUpdates)
+	for _, strategy := range engine.minimumSearch.strategies {
+		definition := minimumSearchStrategies[strategy]
+
+		updates, ok := updatesByOrdering[definition.ordering]
+		if !ok {
+			var err error
+			updates, err = engine.getBlockBalanceUpdates(ctx, state, level, definition.ordering)
+			if err != nil {
+				return nil, err
+			}
+			updatesByOrdering[definition.ordering] = updates
+		}
+
+		var (
+			createdAt common.DelegationStateCreationInfo
+			result    *common.DelegationState
+			found     bool
+		)
+		if definition.closest {
+			createdAt, result, found = findClosestMinimum(state, updates, level, targetAmount, engine.minimumSearch.maxResidual)
+		} else {
+			createdAt, result, found = findMinimum(state, updates, level, targetAmount, engine.minimumSearch.tolerance)
+		}
+		if found {
+			if strategy != common.MinimumSearchStrategyExact {
+				slog.Info("minimum delegated balance found using fallback strategy", "delegate", state.Baker.String(), "cycle", state.Cycle, "strategy", strategy, "residual", createdAt.Residual)
+			}
+			createdAt.Strategy = strategy
+			result.CreatedAt = createdAt
+			return result, nil
+		}
+		slog.Debug("minimum search strategy failed", "delegate", state.Baker.String(), "cycle", state.Cycle, "strategy", strategy)
+	}
+	return nil, constants.ErrMinimumDelegatedBalanceNotFound
+}
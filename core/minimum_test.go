@@ -0,0 +1,315 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/configuration"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/rpc"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+var (
+	minimumBaker      = tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	minimumDelegator  = tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	minimumOtherBaker = tezos.MustParseAddress("tz1S5WxdZR5f9NzsPXhr7L9L1vrEb5spZFur")
+	// not part of the delegation state
+	minimumOutsider = tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+	// delegated to other baker at the beginning of the block
+	minimumNewcomer = tezos.MustParseAddress("tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc")
+)
+
+const minimumLevel = rpc.BlockLevel(100)
+
+// baker 10_000 + delegator 1_000, newcomer is not delegated yet
+func newMinimumTestState() *common.DelegationState {
+	state := common.NewDelegationState(&rpc.Delegate{Delegate: minimumBaker}, 745, rpc.BlockLevel(5799936))
+	state.Parameters = &common.StakingParameters{}
+	state.AddBalance(minimumBaker, common.DelegationStateBalanceInfo{
+		Balance:    common.NewMutez(10_000),
+		Baker:      minimumBaker,
+		StakeBaker: minimumBaker,
+	})
+	state.AddBalance(minimumDelegator, common.DelegationStateBalanceInfo{
+		Balance:    common.NewMutez(1_000),
+		Baker:      minimumBaker,
+		StakeBaker: minimumBaker,
+	})
+	state.AddBalance(minimumNewcomer, common.DelegationStateBalanceInfo{
+		Balance:    common.NewMutez(500),
+		Baker:      minimumOtherBaker,
+		StakeBaker: minimumOtherBaker,
+	})
+	return state
+}
+
+func transfer(address tezos.Address, amount int64, index int) PRBalanceUpdate {
+	return PRBalanceUpdate{Address: address, Amount: amount, Kind: "contract", Index: index, Source: common.CreatedAtTransactionResult}
+}
+
+func TestFindMinimum(t *testing.T) {
+	initial := newMinimumTestState().GetDelegatedBalance().Int64()
+
+	tests := []struct {
+		name     string
+		updates  PRBalanceUpdates
+		target   int64
+		found    bool
+		expected common.DelegationStateCreationInfo
+	}{
+		{
+			name:     "block beginning",
+			updates:  PRBalanceUpdates{transfer(minimumDelegator, -100, 0)},
+			target:   initial - 1,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Kind: common.CreatedAtBlockBeginning, Residual: common.NewMutez(1)},
+		},
+		{
+			name: "transaction result",
+			updates: PRBalanceUpdates{
+				transfer(minimumDelegator, -100, 0),
+				transfer(minimumOutsider, 100, 0),
+				transfer(minimumDelegator, -300, 1),
+				transfer(minimumBaker, 50, 2),
+			},
+			target:   initial - 400,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 1, Kind: common.CreatedAtTransactionResult},
+		},
+		{
+			name: "burns are ignored",
+			updates: PRBalanceUpdates{
+				{Address: minimumBaker, Amount: -400, Kind: "burned", Category: "storage fees", Index: 0, Source: common.CreatedAtTransactionResult},
+				transfer(minimumDelegator, -400, 1),
+			},
+			target:   initial - 400,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 1, Kind: common.CreatedAtTransactionResult},
+		},
+		{
+			name: "delegator leaves",
+			updates: PRBalanceUpdates{
+				transfer(minimumBaker, -100, 0),
+				{Address: minimumDelegator, Index: 1, Source: common.CreatedOnDelegation, Delegate: minimumOtherBaker},
+			},
+			target:   initial - 1_100,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 1, Kind: common.CreatedOnDelegation},
+		},
+		{
+			name: "delegator joins",
+			updates: PRBalanceUpdates{
+				{Address: minimumNewcomer, Index: 3, Source: common.CreatedOnDelegation, Delegate: minimumBaker},
+			},
+			target:   initial + 500,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 3, Kind: common.CreatedOnDelegation},
+		},
+		{
+			name: "internal result",
+			updates: PRBalanceUpdates{
+				{Address: minimumDelegator, Amount: -250, Kind: "contract", Index: 4, InternalIndex: 2, Source: common.CreatedAtTransactionInternalResult},
+			},
+			target:   initial - 250,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 4, InternalIndex: 2, Kind: common.CreatedAtTransactionInternalResult},
+		},
+		{
+			name: "unstaked deposits count as delegated",
+			updates: PRBalanceUpdates{
+				{Address: minimumDelegator, Amount: -300, Kind: "freezer", Category: "deposits", Index: 0, Source: common.CreatedAtTransactionResult},
+				{Address: minimumDelegator, Amount: 300, Kind: "freezer", Category: "unstaked_deposits", Index: 0, Source: common.CreatedAtTransactionResult},
+			},
+			target:   initial + 300,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 0, Kind: common.CreatedAtTransactionResult},
+		},
+		{
+			name: "stake is moved after transfers",
+			updates: makeBurnAndStakeBalanceUpdatesLast([]PRBalanceUpdate{
+				transfer(minimumDelegator, -1_000, 0),
+				{Address: minimumDelegator, Amount: 1_000, Kind: "freezer", Category: "deposits", Index: 0, Source: common.CreatedAtTransactionResult},
+				transfer(minimumDelegator, -50, 1),
+				transfer(minimumOutsider, 50, 1),
+			}),
+			target:   initial - 50,
+			found:    true,
+			expected: common.DelegationStateCreationInfo{Level: 100, Index: 1, Kind: common.CreatedAtTransactionResult},
+		},
+		{
+			name:    "not found",
+			updates: PRBalanceUpdates{transfer(minimumDelegator, -100, 0), transfer(minimumOutsider, -5_000, 1)},
+			target:  initial - 5_000,
+			found:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			state := newMinimumTestState()
+			createdAt, result, found := findMinimum(state, test.updates, minimumLevel, test.target, common.NewMutez(constants.MINIMUM_DIFF_TOLERANCE))
+			assert.Equal(test.found, found)
+			if !test.found {
+				assert.Nil(result)
+				return
+			}
+			assert.Equal(test.expected, createdAt)
+			assert.Equal(createdAt.Residual, result.GetDelegatedBalance().Sub64(test.target))
+			// replay must not affect the original state
+			assert.Equal(initial, state.GetDelegatedBalance().Int64())
+		})
+	}
+}
+
+func TestMakeBurnAndStakeBalanceUpdatesLast(t *testing.T) {
+	assert := assert.New(t)
+
+	stake := []PRBalanceUpdate{
+		transfer(minimumDelegator, -1_000, 0),
+		{Address: minimumDelegator, Amount: 1_000, Kind: "freezer", Category: "deposits", Index: 0},
+	}
+	burn := []PRBalanceUpdate{
+		transfer(minimumDelegator, -10, 0),
+		{Address: minimumDelegator, Amount: 10, Kind: "burned", Category: "storage fees", Index: 0},
+	}
+	regular := []PRBalanceUpdate{transfer(minimumDelegator, -50, 0), transfer(minimumOutsider, 50, 0)}
+
+	updates := append(append(append([]PRBalanceUpdate{}, stake...), burn...), regular...)
+	expected := append(append(append([]PRBalanceUpdate{}, regular...), stake...), burn...)
+	assert.Equal(expected, makeBurnAndStakeBalanceUpdatesLast(updates))
+}
+
+func TestFindClosestMinimum(t *testing.T) {
+	assert := assert.New(t)
+
+	updates := PRBalanceUpdates{
+		transfer(minimumDelegator, -100, 0),
+		transfer(minimumDelegator, -300, 1),
+		transfer(minimumDelegator, 50, 2),
+	}
+	state := newMinimumTestState()
+	initial := state.GetDelegatedBalance()
+	target := initial.Int64() - 370
+
+	createdAt, result, found := findClosestMinimum(state, updates, minimumLevel, target, common.Mutez{})
+	assert.True(found)
+	assert.Equal(2, createdAt.Index)
+	assert.Equal(common.NewMutez(20), createdAt.Residual)
+	assert.Equal(initial.Sub64(350), result.GetDelegatedBalance())
+	assert.Equal(initial, state.GetDelegatedBalance())
+
+	// block beginning is the closest
+	createdAt, _, found = findClosestMinimum(state, updates, minimumLevel, initial.Int64()+10, common.Mutez{})
+	assert.True(found)
+	assert.Equal(common.CreatedAtBlockBeginning, createdAt.Kind)
+	assert.Equal(common.NewMutez(-10), createdAt.Residual)
+
+	_, result, found = findClosestMinimum(state, updates, minimumLevel, target, common.NewMutez(10))
+	assert.False(found)
+	assert.Nil(result)
+}
+
+func TestNewMinimumSearchOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	options := newMinimumSearchOptions(&configuration.MinimumSearchConfiguration{})
+	assert.Equal(common.NewMutez(constants.MINIMUM_DIFF_TOLERANCE), options.tolerance)
+	assert.Equal(defaultMinimumSearchStrategies, options.strategies)
+
+	tolerance := int64(0)
+	options = newMinimumSearchOptions(&configuration.MinimumSearchConfiguration{
+		Tolerance:  &tolerance,
+		Strategies: []string{"unknown", "closest_match", "node_order"},
+	})
+	assert.True(options.tolerance.IsZero())
+	assert.Equal([]common.MinimumSearchStrategy{common.MinimumSearchStrategyClosestMatch, common.MinimumSearchStrategyNodeOrder}, options.strategies)
+}
+
+// decodes pairs of balance updates, 3 bytes each: address, kind and amount
+func decodeFuzzBalanceUpdates(data []byte) PRBalanceUpdates {
+	addresses := []tezos.Address{minimumBaker, minimumDelegator, minimumNewcomer, minimumOutsider}
+	delegates := []tezos.Address{minimumBaker, minimumOtherBaker, tezos.ZeroAddress}
+
+	updates := make(PRBalanceUpdates, 0, len(data)/3)
+	for i := 0; i+6 <= len(data); i += 6 {
+		for j := 0; j < 2; j++ {
+			chunk := data[i+j*3 : i+j*3+3]
+			update := PRBalanceUpdate{
+				Address: addresses[int(chunk[0])%len(addresses)],
+				Amount:  int64(int8(chunk[2])) * 10,
+				Index:   i / 6,
+				Source:  common.CreatedAtTransactionResult,
+			}
+			switch chunk[1] % 6 {
+			case 0:
+				update.Kind = "contract"
+			case 1:
+				update.Kind, update.Category = "burned", "storage fees"
+			case 2:
+				update.Kind, update.Category = "freezer", "deposits"
+			case 3:
+				update.Kind, update.Category = "freezer", "unstaked_deposits"
+			case 4:
+				update.Kind = "staking"
+			case 5:
+				update.Source = common.CreatedOnDelegation
+				update.Amount = 0
+				update.Delegate = delegates[int(chunk[2])%len(delegates)]
+			}
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+func FuzzFindMinimum(f *testing.F) {
+	f.Add([]byte{1, 0, 0xf6, 3, 0, 10, 1, 2, 100, 1, 0, 0x9c}, int64(-100), uint8(1))
+	f.Add([]byte{2, 5, 0, 0, 1, 5, 1, 3, 30, 1, 2, 0xe2}, int64(500), uint8(0))
+	f.Add([]byte{1, 5, 1, 0, 0, 0}, int64(-1_000), uint8(10))
+	f.Add([]byte{}, int64(0), uint8(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, offset int64, tolerance uint8) {
+		state := newMinimumTestState()
+		initialBalances := state.GetDelegatorAndBakerBalances()
+		target := state.GetDelegatedBalance().Int64() + offset
+		initialResidual := state.GetDelegatedBalance().Sub64(target)
+
+		for _, updates := range []PRBalanceUpdates{decodeFuzzBalanceUpdates(data), makeBurnAndStakeBalanceUpdatesLast(decodeFuzzBalanceUpdates(data))} {
+			createdAt, result, found := findMinimum(state, updates, minimumLevel, target, common.NewMutez(int64(tolerance)))
+			createdAtAgain, _, foundAgain := findMinimum(state, updates, minimumLevel, target, common.NewMutez(int64(tolerance)))
+			if found != foundAgain || !assert.ObjectsAreEqual(createdAt, createdAtAgain) {
+				t.Fatalf("search is not deterministic: %+v %+v", createdAt, createdAtAgain)
+			}
+			if found {
+				if createdAt.Residual.Abs().Cmp(common.NewMutez(int64(tolerance))) > 0 {
+					t.Fatalf("residual %s exceeds tolerance %d", createdAt.Residual, tolerance)
+				}
+				if !result.GetDelegatedBalance().Sub64(target).Equal(createdAt.Residual) {
+					t.Fatalf("residual %s does not match the returned state", createdAt.Residual)
+				}
+			}
+
+			closest, closestResult, closestFound := findClosestMinimum(state, updates, minimumLevel, target, common.Mutez{})
+			if !closestFound {
+				t.Fatal("closest match without residual limit must always succeed")
+			}
+			if !closestResult.GetDelegatedBalance().Sub64(target).Equal(closest.Residual) {
+				t.Fatalf("closest residual %s does not match the returned state", closest.Residual)
+			}
+			if initialResidual.Abs().IsLess(closest.Residual.Abs()) {
+				t.Fatalf("closest residual %s is worse than block beginning %s", closest.Residual, initialResidual)
+			}
+			if found && createdAt.Residual.Abs().IsLess(closest.Residual.Abs()) {
+				t.Fatalf("closest residual %s is worse than exact match %s", closest.Residual, createdAt.Residual)
+			}
+		}
+
+		if !assert.ObjectsAreEqual(initialBalances, state.GetDelegatorAndBakerBalances()) {
+			t.Fatal("initial state was modified")
+		}
+	})
+}
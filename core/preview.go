@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/rpc"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type trackedPreview struct {
+	preview     *common.DelegationStatePreview
+	requestedAt time.Time
+}
+
+// keeps previews of recently requested delegates, they are refreshed on new blocks
+type previewTracker struct {
+	mtx      sync.Mutex
+	previews map[tezos.Address]*trackedPreview
+	// times of computations started on request within the last minute
+	computations []time.Time
+	// buffered, heads received while refreshing are coalesced
+	refresh chan struct{}
+}
+
+func newPreviewTracker() *previewTracker {
+	return &previewTracker{
+		previews: make(map[tezos.Address]*trackedPreview),
+		refresh:  make(chan struct{}, 1),
+	}
+}
+
+func (t *previewTracker) notify() {
+	select {
+	case t.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// returns the preview if it is fresh enough and marks the delegate as requested
+func (t *previewTracker) get(delegate tezos.Address, now time.Time) (*common.DelegationStatePreview, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tracked, ok := t.previews[delegate]
+	if !ok {
+		return nil, false
+	}
+	tracked.requestedAt = now
+	if tracked.preview == nil || now.Sub(tracked.preview.ComputedAt) > constants.PREVIEW_MAX_AGE_MINUTES*time.Minute {
+		return nil, false
+	}
+	return tracked.preview, true
+}
+
+// stores the preview, the least recently requested delegate is dropped if there are too many
+func (t *previewTracker) set(delegate tezos.Address, preview *common.DelegationStatePreview, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if tracked, ok := t.previews[delegate]; ok {
+		tracked.preview = preview
+		return
+	}
+	if len(t.previews) >= constants.PREVIEW_MAX_TRACKED_DELEGATES {
+		var oldest tezos.Address
+		for address, tracked := range t.previews {
+			if !oldest.IsValid() || tracked.requestedAt.Before(t.previews[oldest].requestedAt) {
+				oldest = address
+			}
+		}
+		delete(t.previews, oldest)
+	}
+	t.previews[delegate] = &trackedPreview{preview: preview, requestedAt: now}
+}
+
+// refreshed preview, delegates dropped meanwhile are not tracked again
+func (t *previewTracker) update(delegate tezos.Address, preview *common.DelegationStatePreview) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if tracked, ok := t.previews[delegate]; ok {
+		tracked.preview = preview
+	}
+}
+
+// delegates requested recently, the others are not tracked anymore
+func (t *previewTracker) tracked(now time.Time) []tezos.Address {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	result := make([]tezos.Address, 0, len(t.previews))
+	for address, tracked := range t.previews {
+		if now.Sub(tracked.requestedAt) > constants.PREVIEW_TRACKING_MINUTES*time.Minute {
+			delete(t.previews, address)
+			continue
+		}
+		result = append(result, address)
+	}
+	slices.SortFunc(result, func(a, b tezos.Address) int { return strings.Compare(a.String(), b.String()) })
+	return result
+}
+
+// limits computations on request, each of them costs several rpc calls
+func (t *previewTracker) allowComputation(now time.Time) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.computations = slices.DeleteFunc(t.computations, func(computedAt time.Time) bool {
+		return now.Sub(computedAt) >= time.Minute
+	})
+	if len(t.computations) >= constants.PREVIEW_MAX_COMPUTATIONS_PER_MINUTE {
+		return false
+	}
+	t.computations = append(t.computations, now)
+	return true
+}
+
+// computes the state of the running cycle as if it ended at the current head
+func (e *Engine) computeDelegationStatePreview(ctx context.Context, address tezos.Address) (*common.DelegationStatePreview, error) {
+	head, err := e.collector.getHeadBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headId := rpc.BlockLevel(head.Header.Level)
+	cycle := head.GetLevelInfo().Cycle
+
+	delegate, err := e.collector.GetDelegateFromCycle(ctx, headId, address)
+	if err != nil {
+		if errors.Is(err, constants.ErrDelegateNotRegistered) {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+
+	state, err := toStoredDelegationState(e.collector.GetDelegationState(ctx, delegate, cycle, headId))
+	if err != nil {
+		return nil, err
+	}
+	state.LastBlockLevel = head.Header.Level
+	state.LastBlockHash = head.Hash.String()
+
+	return &common.DelegationStatePreview{
+		Provisional:         true,
+		Cycle:               cycle,
+		Level:               head.Header.Level,
+		ComputedAt:          time.Now(),
+		MinDelegatedBalance: common.NewMutez(delegate.MinDelegated.Amount),
+		MinDelegatedLevel:   delegate.MinDelegated.Level.Level,
+		BakingPower:         state.BakingPower(),
+		State:               state,
+	}, nil
+}
+
+// provisional state of the running cycle, served from the tracker if it was refreshed recently
+func (e *Engine) GetDelegationStatePreview(ctx context.Context, address tezos.Address) (*common.DelegationStatePreview, error) {
+	if e.IsOffline() {
+		return nil, constants.ErrEngineOffline
+	}
+	if preview, ok := e.previews.get(address, time.Now()); ok {
+		return preview, nil
+	}
+	if !e.previews.allowComputation(time.Now()) {
+		return nil, constants.ErrTooManyPreviewComputations
+	}
+
+	preview, err := e.computeDelegationStatePreview(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	e.previews.set(address, preview, time.Now())
+	return preview, nil
+}
+
+func (e *Engine) refreshPreviews(ctx context.Context) {
+	for _, address := range e.previews.tracked(time.Now()) {
+		if ctx.Err() != nil || e.state.IsShuttingDown() {
+			return
+		}
+		preview, err := e.computeDelegationStatePreview(ctx, address)
+		if err != nil {
+			e.logger.Warn("failed to refresh delegation state preview", "delegate", address.String(), "error", err.Error())
+			continue
+		}
+		e.previews.update(address, preview)
+	}
+}
+
+// refreshes tracked previews whenever the scheduler sees a new block
+func (e *Engine) refreshPreviewsAutomatically() {
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-e.previews.refresh:
+		}
+		e.refreshPreviews(e.ctx)
+	}
+}
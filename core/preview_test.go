@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestPreviewTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	delegate := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	tracker := newPreviewTracker()
+
+	_, ok := tracker.get(delegate, now)
+	assert.False(ok)
+
+	tracker.set(delegate, &common.DelegationStatePreview{Level: 100, ComputedAt: now}, now)
+	preview, ok := tracker.get(delegate, now)
+	assert.True(ok)
+	assert.Equal(int64(100), preview.Level)
+
+	tracker.update(delegate, &common.DelegationStatePreview{Level: 101, ComputedAt: now})
+	preview, _ = tracker.get(delegate, now)
+	assert.Equal(int64(101), preview.Level)
+
+	// stale previews are recomputed on request but the delegate stays tracked
+	_, ok = tracker.get(delegate, now.Add(constants.PREVIEW_MAX_AGE_MINUTES*time.Minute+time.Second))
+	assert.False(ok)
+	assert.Equal([]tezos.Address{delegate}, tracker.tracked(now))
+
+	// delegates not requested recently are dropped
+	assert.Empty(tracker.tracked(now.Add(2 * constants.PREVIEW_TRACKING_MINUTES * time.Minute)))
+	tracker.update(delegate, &common.DelegationStatePreview{Level: 102, ComputedAt: now})
+	_, ok = tracker.get(delegate, now)
+	assert.False(ok)
+}
+
+func TestPreviewTrackerEvictsLeastRecentlyRequested(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	tracker := newPreviewTracker()
+	addresses := make([]tezos.Address, 0, constants.PREVIEW_MAX_TRACKED_DELEGATES+1)
+	for i := 0; i <= constants.PREVIEW_MAX_TRACKED_DELEGATES; i++ {
+		addresses = append(addresses, tezos.NewAddress(tezos.AddressTypeEd25519, []byte(fmt.Sprintf("%020d", i))))
+	}
+
+	for i, address := range addresses[:constants.PREVIEW_MAX_TRACKED_DELEGATES] {
+		tracker.set(address, &common.DelegationStatePreview{ComputedAt: now}, now.Add(time.Duration(i)*time.Second))
+	}
+	tracker.get(addresses[0], now.Add(time.Hour)) // refreshes the oldest one
+	tracker.set(addresses[constants.PREVIEW_MAX_TRACKED_DELEGATES], &common.DelegationStatePreview{ComputedAt: now}, now.Add(time.Hour))
+
+	tracked := tracker.tracked(now)
+	assert.Len(tracked, constants.PREVIEW_MAX_TRACKED_DELEGATES)
+	assert.Contains(tracked, addresses[0])
+	assert.NotContains(tracked, addresses[1])
+}
+
+func TestPreviewTrackerComputationLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	tracker := newPreviewTracker()
+	for range constants.PREVIEW_MAX_COMPUTATIONS_PER_MINUTE {
+		assert.True(tracker.allowComputation(now))
+	}
+	assert.False(tracker.allowComputation(now.Add(30 * time.Second)))
+	assert.True(tracker.allowComputation(now.Add(time.Minute)))
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/rpc"
+)
+
+// follows the chain head and fetches cycles as soon as they are final
+type scheduler struct {
+	engine *Engine
+	// buffered, triggers received while fetching are coalesced
+	trigger chan struct{}
+
+	mtx    sync.RWMutex
+	status common.SchedulerStatus
+}
+
+func newScheduler(engine *Engine) *scheduler {
+	return &scheduler{
+		engine:  engine,
+		trigger: make(chan struct{}, 1),
+		status: common.SchedulerStatus{
+			Mode: common.SchedulerModeMonitor,
+		},
+	}
+}
+
+// returns the next cycle to become final and its last block
+func nextCycleEnd(level, cycle, cyclePosition, blocksPerCycle, confirmations int64) (int64, int64) {
+	previousCycleEnd := level - cyclePosition - 1
+	if level-previousCycleEnd < confirmations {
+		return cycle - 1, previousCycleEnd
+	}
+	return cycle, previousCycleEnd + blocksPerCycle
+}
+
+// exponential backoff, capped
+func schedulerRetryDelay(failures int) time.Duration {
+	delay := constants.SCHEDULER_RETRY_BASE_DELAY_SECONDS * time.Second
+	for i := 1; i < failures && delay < constants.SCHEDULER_RETRY_MAX_DELAY_MINUTES*time.Minute; i++ {
+		delay *= 2
+	}
+	return min(delay, constants.SCHEDULER_RETRY_MAX_DELAY_MINUTES*time.Minute)
+}
+
+func (s *scheduler) Status() common.SchedulerStatus {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.status
+}
+
+func (s *scheduler) Run(ctx context.Context) {
+	go s.processTriggers(ctx)
+	s.followHeads(ctx)
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) onHead(level int64) {
+	now := time.Now()
+	s.mtx.Lock()
+	newBlock := level != s.status.LastHeadLevel
+	s.status.LastHeadLevel = level
+	s.status.LastHeadAt = &now
+	// trigger level is unknown until the first successful run
+	due := s.status.NextTriggerLevel == 0 || level >= s.status.NextTriggerLevel
+	s.mtx.Unlock()
+
+	if due {
+		s.notify()
+	}
+	if newBlock && s.engine != nil {
+		s.engine.previews.notify()
+	}
+}
+
+func (s *scheduler) setMode(mode common.SchedulerMode) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.status.Mode = mode
+}
+
+func (s *scheduler) getMode() common.SchedulerMode {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.status.Mode
+}
+
+// subscribes to the head stream and reconnects with backoff, falls back to polling if the node does not support monitoring
+func (s *scheduler) followHeads(ctx context.Context) {
+	clients := s.engine.collector.rpcs
+	failures := 0
+	for i := 0; ctx.Err() == nil; i++ {
+		mode := s.getMode()
+
+		var (
+			received int
+			err      error
+		)
+		switch mode {
+		case common.SchedulerModeMonitor:
+			// rotate providers on reconnect
+			received, err = s.monitorHeads(ctx, clients[i%len(clients)])
+		default:
+			received, err = s.pollHeads(ctx)
+		}
+		if ctx.Err() != nil || s.engine.state.IsShuttingDown() {
+			return
+		}
+
+		if mode == common.SchedulerModeMonitor && rpc.ErrorStatus(err) == http.StatusNotFound {
+			s.engine.logger.Info("head monitoring is not supported by the node, falling back to polling")
+			s.setMode(common.SchedulerModePolling)
+			continue
+		}
+
+		if received > 0 {
+			failures = 0
+		}
+		failures++
+		delay := schedulerRetryDelay(failures)
+		s.engine.logger.Warn("lost connection to the chain head, reconnecting", "mode", mode, "delay", delay, "error", err)
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return
+		}
+	}
+}
+
+// returns number of received heads and the error which ended the stream
+func (s *scheduler) monitorHeads(ctx context.Context, client *rpc.Client) (int, error) {
+	monitor := rpc.NewBlockHeaderMonitor()
+	defer monitor.Close()
+	if err := client.MonitorBlockHeader(ctx, monitor); err != nil {
+		return 0, err
+	}
+
+	received := 0
+	for {
+		head, err := monitor.Recv(ctx)
+		if err != nil {
+			return received, err
+		}
+		received++
+		s.onHead(head.Level)
+	}
+}
+
+func (s *scheduler) pollHeads(ctx context.Context) (int, error) {
+	received := 0
+	for {
+		header, err := attemptWithClients(ctx, s.engine.collector.rpcs, func(client *rpc.Client) (*rpc.BlockHeader, error) {
+			return client.GetTipHeader(ctx)
+		})
+		if err != nil {
+			return received, err
+		}
+		received++
+		s.onHead(header.Level)
+
+		if err := sleepWithContext(ctx, constants.SCHEDULER_POLL_INTERVAL_SECONDS*time.Second); err != nil {
+			return received, err
+		}
+	}
+}
+
+// runs on start and then whenever the next cycle end is final, failed runs are retried with backoff
+func (s *scheduler) processTriggers(ctx context.Context) {
+	s.notify() // catch up with cycles completed while not running
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.trigger:
+		}
+		if s.engine.state.IsShuttingDown() {
+			return
+		}
+
+		err := s.run(ctx)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil || s.engine.state.IsShuttingDown() {
+			return // cycle is resumed on the next start
+		}
+
+		s.mtx.Lock()
+		s.status.ConsecutiveFailures++
+		s.status.LastError = err.Error()
+		failures := s.status.ConsecutiveFailures
+		s.mtx.Unlock()
+
+		delay := schedulerRetryDelay(failures)
+		s.engine.logger.Error("scheduled cycle fetch failed, retrying", "failures", failures, "delay", delay, "error", err.Error())
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return
+		}
+		s.notify()
+	}
+}
+
+func (s *scheduler) run(ctx context.Context) error {
+	if err := s.fetchCompletedCycles(ctx); err != nil {
+		return err
+	}
+	if err := s.resumeUnfinishedCycles(ctx); err != nil {
+		return err
+	}
+
+	cycle, lastBlockLevel, err := s.engine.collector.GetNextCycleEnd(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.status.NextCycle = cycle
+	s.status.NextCycleEndLevel = lastBlockLevel
+	s.status.NextTriggerLevel = lastBlockLevel + s.engine.collector.confirmations
+	s.status.ConsecutiveFailures = 0
+	s.status.LastError = ""
+	return nil
+}
+
+func (s *scheduler) recordTrigger(cycle int64) {
+	now := time.Now()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.status.LastTriggerAt = &now
+	s.status.LastTriggerCycle = cycle
+}
+
+// fetches all cycles completed since the last fetched one, a failed cycle is retried on the next run
+func (s *scheduler) fetchCompletedCycles(ctx context.Context) error {
+	e := s.engine
+	lastOnChainCompletedCycle, lastBlockInTheCycle, err := e.collector.GetLastCompletedCycle(ctx)
+	if err != nil {
+		e.logger.Error("failed to fetch last completed cycle number", "error", err.Error())
+		return err
+	}
+
+	lastFetchedCycle := e.state.GetLastFetchedCycle()
+	if lastFetchedCycle >= lastOnChainCompletedCycle {
+		e.logger.Debug("no new cycle completed", "last_fetched_cycle", lastFetchedCycle, "last_on_chain_completed_cycle", lastOnChainCompletedCycle)
+		return nil
+	}
+
+	if lastFetchedCycle == 0 {
+		cycle, _ := e.store.GetLastFetchedCycle()
+		switch cycle {
+		case 0:
+			e.state.SetLastFetchedCycle(lastOnChainCompletedCycle - 1)
+		default:
+			e.state.SetLastFetchedCycle(cycle)
+		}
+		lastFetchedCycle = e.state.GetLastFetchedCycle()
+	}
+
+	if lastFetchedCycle+1 <= lastOnChainCompletedCycle {
+		e.logger.Info("fetching missing delegation states", "last_fetched_cycle", lastFetchedCycle, "last_on_chain_completed_cycle", lastOnChainCompletedCycle)
+	}
+
+	for cycle := lastFetchedCycle + 1; cycle <= lastOnChainCompletedCycle; cycle++ {
+		// this is not ideal but we can not determine last block on testnets easily
+		// so we try to use available last block level, if not fall back to lookup in cycle table which works on mainnet and networks with known parameters by tzgo
+		lastBlock := int64(0)
+		if cycle == lastOnChainCompletedCycle {
+			lastBlock = lastBlockInTheCycle
+		}
+
+		s.recordTrigger(cycle)
+		if err := e.FetchCycleDelegationStates(ctx, cycle, lastBlock, nil); err != nil {
+			e.logger.Error("failed to fetch cycle delegation states", "cycle", cycle, "error", err.Error())
+			return err
+		}
+		if err := e.store.PruneDelegationState(cycle); err != nil {
+			e.logger.Error("failed to prune cycles out", "error", err.Error())
+		}
+		e.state.SetLastFetchedCycle(cycle)
+	}
+	return nil
+}
+
+// completes cycles fetched before which were interrupted or invalidated by a reorganization,
+// only delegates which did not succeed are fetched again
+func (s *scheduler) resumeUnfinishedCycles(ctx context.Context) error {
+	e := s.engine
+	lastFetchedCycle := e.state.GetLastFetchedCycle()
+	cycleFetches, err := e.store.GetUnfinishedCycleFetches(lastFetchedCycle-constants.STORED_CYCLES, lastFetchedCycle)
+	if err != nil {
+		return err
+	}
+
+	for _, cycleFetch := range cycleFetches {
+		e.logger.Info("resuming unfinished cycle fetch", "cycle", cycleFetch.Cycle)
+		s.recordTrigger(cycleFetch.Cycle)
+		if err := e.FetchCycleDelegationStates(ctx, cycleFetch.Cycle, cycleFetch.LastBlockLevel, nil); err != nil {
+			e.logger.Error("failed to resume cycle fetch", "cycle", cycleFetch.Cycle, "error", err.Error())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/constants"
+)
+
+func TestNextCycleEnd(t *testing.T) {
+	assert := assert.New(t)
+
+	// first block of cycle 750, the last block of 749 needs one more confirmation
+	cycle, level := nextCycleEnd(5_760_001, 750, 0, 24_576, 2)
+	assert.Equal(int64(749), cycle)
+	assert.Equal(int64(5_760_000), level)
+
+	cycle, level = nextCycleEnd(5_760_002, 750, 1, 24_576, 2)
+	assert.Equal(int64(750), cycle)
+	assert.Equal(int64(5_784_576), level)
+
+	// without confirmations the current cycle is always the next one
+	cycle, level = nextCycleEnd(5_760_001, 750, 0, 24_576, 0)
+	assert.Equal(int64(750), cycle)
+	assert.Equal(int64(5_784_576), level)
+}
+
+func TestSchedulerRetryDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	base := constants.SCHEDULER_RETRY_BASE_DELAY_SECONDS * time.Second
+	assert.Equal(base, schedulerRetryDelay(1))
+	assert.Equal(4*base, schedulerRetryDelay(3))
+	assert.Equal(constants.SCHEDULER_RETRY_MAX_DELAY_MINUTES*time.Minute, schedulerRetryDelay(100))
+}
+
+func TestSchedulerOnHead(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newScheduler(nil)
+	s.onHead(100)
+	assert.Len(s.trigger, 1, "unknown trigger level triggers on any head")
+	s.onHead(101)
+	assert.Len(s.trigger, 1, "triggers are coalesced")
+	<-s.trigger
+
+	s.status.NextTriggerLevel = 110
+	s.onHead(109)
+	assert.Len(s.trigger, 0)
+	s.onHead(110)
+	assert.Len(s.trigger, 1)
+
+	status := s.Status()
+	assert.Equal(int64(110), status.LastHeadLevel)
+	assert.NotNil(status.LastHeadAt)
+}
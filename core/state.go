@@ -15,6 +15,10 @@ var (
 type state struct {
 	lastFetchedCycle      int64
 	delegatesBeingFetched map[int64][]tezos.Address
+	shuttingDown          bool
+	runningFetches        int
+	// running fetches, waited for on shutdown
+	fetches sync.WaitGroup
 }
 
 func newState() *state {
@@ -59,6 +63,58 @@ func (s *state) IsDelegateBeingFetched(cycle int64, delegate tezos.Address) bool
 	return slices.Contains(s.delegatesBeingFetched[cycle], delegate)
 }
 
+// registers running fetch, returns false if the engine is shutting down and no new fetch should start
+func (s *state) BeginFetch() bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if s.shuttingDown {
+		return false
+	}
+	s.runningFetches++
+	s.fetches.Add(1)
+	return true
+}
+
+func (s *state) EndFetch() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	s.runningFetches--
+	s.fetches.Done()
+}
+
+// closed once all running fetches ended, no fetch starts after BeginShutdown
+func (s *state) FetchesDone() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		s.fetches.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (s *state) GetRunningFetches() int {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	return s.runningFetches
+}
+
+func (s *state) BeginShutdown() {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	s.shuttingDown = true
+}
+
+func (s *state) IsShuttingDown() bool {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	return s.shuttingDown
+}
+
 func (s *state) SetLastFetchedCycle(cycle int64) {
 	mtx.Lock()
 	defer mtx.Unlock()
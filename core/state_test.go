@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateFetchesDone(t *testing.T) {
+	assert := assert.New(t)
+
+	state := newState()
+	assert.True(state.BeginFetch())
+	done := state.FetchesDone()
+
+	state.BeginShutdown()
+	assert.False(state.BeginFetch())
+	select {
+	case <-done:
+		assert.Fail("fetch is still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	state.EndFetch()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail("running fetch ended")
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+var (
+	tzktBaker   = tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	tzktStakerA = tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+	tzktStakerB = tezos.MustParseAddress("tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc")
+	tzktStakerC = tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+)
+
+// serves unstake requests the way tzkt does, paginated by id cursor
+func newTzktStandIn(t *testing.T, stakers []string) (*httptest.Server, *[]string) {
+	queries := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/staking/unstake_requests" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		queries = append(queries, r.URL.RawQuery)
+		if query.Get("baker") != tzktBaker.String() || query.Get("staker.ne") != tzktBaker.String() || query.Get("firstLevel.le") != "100" {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		cursor, _ := strconv.Atoi(query.Get("offset.cr"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		page := make([]tzktUnstakeRequest, 0, limit)
+		for id := cursor + 1; id <= len(stakers) && len(page) < limit; id++ {
+			request := tzktUnstakeRequest{Id: int64(id)}
+			request.Staker.Address = stakers[id-1]
+			page = append(page, request)
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func newTzktTestCollector(urls ...string) *rpcCollector {
+	return &rpcCollector{
+		tzktUrls:     urls,
+		client:       http.DefaultClient,
+		tzktPageSize: 2,
+	}
+}
+
+func TestGetUnstakeRequestsCandidatesPagination(t *testing.T) {
+	assert := assert.New(t)
+
+	server, queries := newTzktStandIn(t, []string{
+		tzktStakerA.String(),
+		tzktStakerB.String(),
+		tzktStakerA.String(),
+		tzktStakerC.String(),
+	})
+	collector := newTzktTestCollector(server.URL + "/")
+
+	candidates, err := collector.getUnstakeRequestsCandidates(defaultCtx, tzktBaker, 100)
+	assert.Nil(err)
+	assert.Equal([]tezos.Address{tzktStakerA, tzktStakerB, tzktStakerC}, candidates)
+	// 2 full pages and an empty one
+	assert.Equal(3, len(*queries))
+}
+
+func TestGetUnstakeRequestsCandidatesFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	server, _ := newTzktStandIn(t, []string{tzktStakerA.String(), tzktStakerB.String(), tzktStakerC.String()})
+	collector := newTzktTestCollector(failing.URL+"/", server.URL+"/")
+
+	candidates, err := collector.getUnstakeRequestsCandidates(defaultCtx, tzktBaker, 100)
+	assert.Nil(err)
+	assert.Equal([]tezos.Address{tzktStakerA, tzktStakerB, tzktStakerC}, candidates)
+}
+
+func TestGetUnstakeRequestsCandidatesPartialResult(t *testing.T) {
+	assert := assert.New(t)
+
+	// second page contains invalid address, we must not return the first page only
+	server, _ := newTzktStandIn(t, []string{tzktStakerA.String(), tzktStakerB.String(), "invalid"})
+	collector := newTzktTestCollector(server.URL + "/")
+
+	ctx, cancel := context.WithTimeout(defaultCtx, time.Second)
+	defer cancel()
+	candidates, err := collector.getUnstakeRequestsCandidates(ctx, tzktBaker, 100)
+	assert.ErrorIs(err, constants.ErrUnstakeRequestsCandidatesIncomplete)
+	assert.Nil(candidates)
+}
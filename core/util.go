@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -50,9 +51,15 @@ func runInParallel[T any](ctx context.Context, collection []T, parallelInstances
 	return nil
 }
 
-func abs(x int64) int64 {
-	if x < 0 {
-		return -x
+// sleeps for the given duration, returns early with the context error if the context is done
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	return x
 }
@@ -11,11 +11,14 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/tez-capital/protocol-rewards/api"
 	"github.com/tez-capital/protocol-rewards/configuration"
 	"github.com/tez-capital/protocol-rewards/constants"
 	"github.com/tez-capital/protocol-rewards/core"
+	"github.com/tez-capital/protocol-rewards/snapshot"
+	"github.com/tez-capital/protocol-rewards/store"
 	"github.com/tez-capital/protocol-rewards/test"
 	"github.com/trilitech/tzgo/tezos"
 )
@@ -62,12 +65,103 @@ func run_test(ctx context.Context, testFlag string, config *configuration.Runtim
 	engine.FetchCycleDelegationStates(ctx, cycle, 0, &core.ForceFetchOptions)
 }
 
+func parseSnapshotTarget(target string) (tezos.Address, int64, error) {
+	address, cycle, ok := strings.Cut(target, ":")
+	if !ok {
+		return tezos.InvalidAddress, 0, fmt.Errorf("expected <address>:<cycle>, got %s", target)
+	}
+	delegate, err := tezos.ParseAddress(address)
+	if err != nil {
+		return tezos.InvalidAddress, 0, err
+	}
+	cycleNumber, err := strconv.ParseInt(cycle, 10, 64)
+	if err != nil {
+		return tezos.InvalidAddress, 0, err
+	}
+	return delegate, cycleNumber, nil
+}
+
+func run_export_snapshot(ctx context.Context, target string, output string, config *configuration.Runtime) {
+	delegate, cycle, err := parseSnapshotTarget(target)
+	if err != nil {
+		slog.Error("invalid snapshot target", "error", err.Error())
+		os.Exit(1)
+	}
+	if output == "" {
+		output = fmt.Sprintf("%s_%d%s", delegate.String(), cycle, constants.SNAPSHOT_FILE_EXTENSION)
+	}
+
+	engine, err := core.NewEngine(ctx, config, core.TestEngineOptions)
+	if err != nil {
+		slog.Error("failed to create engine", "error", err.Error())
+		os.Exit(1)
+	}
+
+	file, err := engine.ExportSnapshot(ctx, delegate, cycle, config.Snapshot.SigningKey)
+	if err != nil {
+		slog.Error("failed to export snapshot", "delegate", delegate.String(), "cycle", cycle, "error", err.Error())
+		os.Exit(1)
+	}
+	if err := snapshot.WriteFile(output, file); err != nil {
+		slog.Error("failed to write snapshot", "path", output, "error", err.Error())
+		os.Exit(1)
+	}
+	slog.Info("snapshot exported", "delegate", delegate.String(), "cycle", cycle, "path", output, "signer", file.Signer.String())
+}
+
+// verifies the snapshot and loads it into the store unless verifyOnly is set, no rpc access is needed
+func run_import_snapshot(path string, verifyOnly bool, config *configuration.Runtime) {
+	file, err := snapshot.ReadFile(path)
+	if err != nil {
+		slog.Error("failed to read snapshot", "path", path, "error", err.Error())
+		os.Exit(1)
+	}
+	payload, err := file.Verify(config.Snapshot.TrustedKeys)
+	if err != nil {
+		slog.Error("snapshot verification failed", "path", path, "error", err.Error())
+		os.Exit(1)
+	}
+	slog.Info("snapshot verified", "delegate", payload.State.Delegate.String(), "cycle", payload.Cycle, "origin_cycle", payload.State.Cycle, "protocol", payload.Protocol.String(), "last_block_level", payload.LastBlockLevel, "last_block_hash", payload.LastBlockHash.String(), "signer", file.Signer.String())
+	if verifyOnly {
+		return
+	}
+
+	store, err := store.NewStore(config)
+	if err != nil {
+		slog.Error("failed to create store", "error", err.Error())
+		os.Exit(1)
+	}
+	if err := snapshot.Import(store, payload, file.Signer); err != nil {
+		slog.Error("failed to import snapshot", "path", path, "error", err.Error())
+		os.Exit(1)
+	}
+	slog.Info("snapshot imported", "delegate", payload.State.Delegate.String(), "cycle", payload.Cycle)
+}
+
+// moves the database schema to the target, up, down, status or a schema version
+func run_migrate(target string, config *configuration.Runtime) {
+	status, err := store.Migrate(config, target)
+	if err != nil {
+		slog.Error("migration failed", "target", target, "error", err.Error())
+		os.Exit(1)
+	}
+	for _, version := range status.Applied {
+		slog.Info("applied migration", "version", version.Version, "name", version.Name, "applied_at", version.AppliedAt)
+	}
+	slog.Info("database schema", "version", status.Current, "latest", status.Latest, "pending", status.Pending())
+}
+
 func main() {
 	configPath := flag.String("config", "config.hjson", "path to the configuration file")
 	logLevel := flag.String("log", "", "set the desired log level")
 	isTest := flag.String("test", "", "run tests")
 	cacheId := flag.String("cache", "", "cache id")
 	versionFlag := flag.Bool("version", false, "print version")
+	exportSnapshot := flag.String("export-snapshot", "", "export signed snapshot of <address>:<cycle>")
+	snapshotOutput := flag.String("snapshot-out", "", "path of the exported snapshot")
+	importSnapshot := flag.String("import-snapshot", "", "verify and import snapshot file into the store")
+	verifySnapshot := flag.String("verify-snapshot", "", "verify snapshot file without importing it")
+	migrate := flag.String("migrate", "", "migrate the database schema (up, down, status or schema version)")
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -79,6 +173,9 @@ func main() {
 		fmt.Printf("%s -log <logLevel> (debug, info, warn, error)\n", os.Args[0])
 		fmt.Printf("%s -test <address>:<cycle> or <cycle>\n", os.Args[0])
 		fmt.Printf("%s -cache test/data/745 (only in combination with -test)\n", os.Args[0])
+		fmt.Printf("%s -export-snapshot <address>:<cycle> -snapshot-out <path>\n", os.Args[0])
+		fmt.Printf("%s -import-snapshot <path> or -verify-snapshot <path>\n", os.Args[0])
+		fmt.Printf("%s -migrate <up|down|status|version>\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -103,6 +200,18 @@ func main() {
 	case *isTest != "":
 		run_test(ctx, *isTest, config, cacheId)
 		return
+	case *exportSnapshot != "":
+		run_export_snapshot(ctx, *exportSnapshot, *snapshotOutput, config)
+		return
+	case *importSnapshot != "":
+		run_import_snapshot(*importSnapshot, false, config)
+		return
+	case *verifySnapshot != "":
+		run_import_snapshot(*verifySnapshot, true, config)
+		return
+	case *migrate != "":
+		run_migrate(*migrate, config)
+		return
 	}
 
 	engine, err := core.NewEngine(ctx, config, core.DefaultEngineOptions)
@@ -117,11 +226,15 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	<-c
+	// let running fetches finish first, api stays available to report shutdown status meanwhile
+	if err := engine.Shutdown(constants.SHUTDOWN_TIMEOUT_SECONDS * time.Second); err != nil {
+		slog.Warn("engine did not shut down cleanly", "error", err.Error())
+	}
+	cancel()
 	publicApiApp.Shutdown()
 	if privateApiApp != nil {
 		privateApiApp.Shutdown()
 	}
-	cancel()
 }
 
 func showTestExample() {
@@ -0,0 +1,139 @@
+// Package snapshot exports delegation states as signed self-contained files
+// so payouts can be computed on machines without network access.
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/tez-capital/protocol-rewards/store"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+type Payload struct {
+	Version int `json:"version"`
+	// cycle the snapshot was requested for, the state carries the baking power origin cycle
+	Cycle                int64              `json:"cycle"`
+	Protocol             tezos.ProtocolHash `json:"protocol"`
+	LastBlockLevel       int64              `json:"last_block_level"`
+	LastBlockHash        tezos.BlockHash    `json:"last_block_hash"`
+	ConsensusRightsDelay int64              `json:"consensus_rights_delay"`
+	ExportedAt           time.Time          `json:"exported_at"`
+
+	State common.StoredDelegationState `json:"state"`
+}
+
+// payload is kept as raw bytes, the signature is verified against exactly what was signed
+type File struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signer    tezos.Key       `json:"signer"`
+	Signature tezos.Signature `json:"signature"`
+}
+
+func Sign(payload *Payload, key tezos.PrivateKey) (*File, error) {
+	if !key.IsValid() {
+		return nil, constants.ErrSnapshotSigningKeyNotConfigured
+	}
+	payload.Version = constants.SNAPSHOT_VERSION
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	digest := tezos.Digest(data)
+	signature, err := key.Sign(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		Payload:   data,
+		Signer:    key.Public(),
+		Signature: signature,
+	}, nil
+}
+
+// checks the signer is trusted and the signature matches, returns the decoded payload
+func (f *File) Verify(trustedKeys []tezos.Key) (*Payload, error) {
+	if !slices.ContainsFunc(trustedKeys, f.Signer.IsEqual) {
+		return nil, errors.Join(constants.ErrSnapshotUntrustedSigner, errors.New(f.Signer.String()))
+	}
+
+	digest := tezos.Digest(f.Payload)
+	if err := f.Signer.Verify(digest[:], f.Signature); err != nil {
+		return nil, errors.Join(constants.ErrSnapshotInvalidSignature, err)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(f.Payload, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Version != constants.SNAPSHOT_VERSION {
+		return nil, constants.ErrSnapshotUnsupportedVersion
+	}
+	return &payload, nil
+}
+
+// gzip compressed json
+func Write(w io.Writer, f *File) error {
+	writer := gzip.NewWriter(w)
+	if err := json.NewEncoder(writer).Encode(f); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func Read(r io.Reader) (*File, error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var result File
+	if err := json.NewDecoder(reader).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func WriteFile(path string, f *File) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(file, f); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func ReadFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// loads verified payload into the store, the state becomes available through the api
+func Import(s *store.Store, payload *Payload, signer tezos.Key) error {
+	return s.ImportDelegationState(&payload.State, &store.StoredSnapshotImport{
+		Delegate:             payload.State.Delegate,
+		Cycle:                payload.State.Cycle,
+		Protocol:             payload.Protocol.String(),
+		LastBlockLevel:       payload.LastBlockLevel,
+		LastBlockHash:        payload.LastBlockHash.String(),
+		ConsensusRightsDelay: payload.ConsensusRightsDelay,
+		Signer:               signer.String(),
+	})
+}
@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+var (
+	baker     = tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator = tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+)
+
+func newTestPayload() *Payload {
+	return &Payload{
+		Cycle:                750,
+		Protocol:             tezos.MustParseProtocolHash("PtParisBxoLz5gzMmn3d9WBQNoPSZakgnkMC2VNuQ3KXfUtUQeZ"),
+		LastBlockLevel:       5799936,
+		LastBlockHash:        tezos.MustParseBlockHash("BLockGenesisGenesisGenesisGenesisGenesisf79b5d1CoW2"),
+		ConsensusRightsDelay: 2,
+		State: common.StoredDelegationState{
+			Delegate: common.Address{Address: baker},
+			Cycle:    747,
+			Balances: common.DelegatedBalances{
+				baker:     {DelegatedBalance: common.MustParseMutez("92233720368547758070")},
+				delegator: {DelegatedBalance: common.NewMutez(1_000), StakedBalance: common.NewMutez(500)},
+			},
+			StakingParameters: common.StakingParameters{LimitOfStakingOverBakingMillionth: 5_000_000},
+			CreatedAt:         common.DelegationStateCreationInfo{Level: 5799000, Kind: common.CreatedAtBlockBeginning, Strategy: common.MinimumSearchStrategyExact},
+		},
+	}
+}
+
+func TestSignWriteReadVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := tezos.GenerateKey(tezos.KeyTypeEd25519)
+	assert.Nil(err)
+
+	file, err := Sign(newTestPayload(), key)
+	assert.Nil(err)
+
+	var buffer bytes.Buffer
+	assert.Nil(Write(&buffer, file))
+	read, err := Read(&buffer)
+	assert.Nil(err)
+
+	payload, err := read.Verify([]tezos.Key{key.Public()})
+	assert.Nil(err)
+	expected := newTestPayload()
+	expected.Version = constants.SNAPSHOT_VERSION
+	assert.Equal(expected, payload)
+}
+
+func TestVerifyRejectsTamperedAndUntrusted(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := tezos.GenerateKey(tezos.KeyTypeEd25519)
+	other, _ := tezos.GenerateKey(tezos.KeyTypeEd25519)
+
+	file, err := Sign(newTestPayload(), key)
+	assert.Nil(err)
+
+	_, err = file.Verify([]tezos.Key{other.Public()})
+	assert.ErrorIs(err, constants.ErrSnapshotUntrustedSigner)
+	_, err = file.Verify(nil)
+	assert.ErrorIs(err, constants.ErrSnapshotUntrustedSigner)
+
+	file.Payload = bytes.Replace(file.Payload, []byte(`"1000"`), []byte(`"1001"`), 1)
+	_, err = file.Verify([]tezos.Key{key.Public()})
+	assert.ErrorIs(err, constants.ErrSnapshotInvalidSignature)
+
+	_, err = Sign(newTestPayload(), tezos.PrivateKey{})
+	assert.ErrorIs(err, constants.ErrSnapshotSigningKeyNotConfigured)
+}
@@ -0,0 +1,19 @@
+package store
+
+import (
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func (s *Store) RecordFetchAudit(audit *common.StoredFetchAudit) error {
+	return s.db.Create(audit).Error
+}
+
+// fetches of the delegate in the cycle, oldest first
+func (s *Store) GetFetchAudits(delegate tezos.Address, cycle int64) ([]common.StoredFetchAudit, error) {
+	audits := []common.StoredFetchAudit{}
+	if err := s.db.Model(&common.StoredFetchAudit{}).Where("delegate = ? AND cycle = ?", common.Address{Address: delegate}, cycle).Order("id asc").Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
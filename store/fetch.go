@@ -0,0 +1,198 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// progress of a cycle fetch, a cycle is finished only after all its delegates were processed
+type StoredCycleFetch struct {
+	Cycle          int64      `json:"cycle" gorm:"primaryKey"`
+	LastBlockLevel int64      `json:"last_block_level"`
+	DelegatesCount int        `json:"delegates_count"`
+	Finished       bool       `json:"finished"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// exponential backoff, capped
+func delegateRetryDelay(attempts int) time.Duration {
+	delay := constants.DELEGATE_RETRY_BASE_DELAY_MINUTES * time.Minute
+	for i := 1; i < attempts && delay < constants.DELEGATE_RETRY_MAX_DELAY_MINUTES*time.Minute; i++ {
+		delay *= 2
+	}
+	return min(delay, constants.DELEGATE_RETRY_MAX_DELAY_MINUTES*time.Minute)
+}
+
+// records the cycle fetch and all expected delegates, delegates recorded before keep their status
+func (s *Store) StartCycleFetch(cycle, lastBlockLevel int64, delegates []tezos.Address) error {
+	slog.Debug("starting cycle fetch", "cycle", cycle, "delegates", len(delegates))
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&StoredCycleFetch{
+			Cycle:          cycle,
+			LastBlockLevel: lastBlockLevel,
+			DelegatesCount: len(delegates),
+			StartedAt:      now,
+		}).Error; err != nil {
+			return err
+		}
+		// refetch of a finished cycle keeps it finished, the last fetched cycle must not go backwards
+		if err := tx.Model(&StoredCycleFetch{}).Where("cycle = ?", cycle).Updates(map[string]interface{}{
+			"last_block_level": lastBlockLevel,
+			"delegates_count":  len(delegates),
+			"started_at":       now,
+		}).Error; err != nil {
+			return err
+		}
+		if len(delegates) == 0 {
+			return nil
+		}
+
+		records := lo.Map(delegates, func(delegate tezos.Address, _ int) common.StoredDelegateFetch {
+			return common.StoredDelegateFetch{
+				Cycle:    cycle,
+				Delegate: common.Address{Address: delegate},
+				Status:   common.DelegateFetchStatusPending,
+			}
+		})
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(records, 500).Error
+	})
+}
+
+func (s *Store) FinishCycleFetch(cycle int64) error {
+	return s.db.Model(&StoredCycleFetch{}).Where("cycle = ?", cycle).Updates(map[string]interface{}{
+		"finished":    true,
+		"finished_at": time.Now(),
+	}).Error
+}
+
+// attempts counts failed fetches only, a delegate is retried until it fails DELEGATE_RETRY_MAX_ATTEMPTS times
+func applyDelegateFetchResult(record *common.StoredDelegateFetch, fetchErr error, now time.Time) {
+	record.Status = common.DelegateFetchStatusSucceeded
+	record.Error = ""
+	record.NextRetryAt = nil
+	if fetchErr == nil {
+		return
+	}
+	record.Attempts++
+	record.Status = common.DelegateFetchStatusFailed
+	record.Error = fetchErr.Error()
+	if record.Attempts < constants.DELEGATE_RETRY_MAX_ATTEMPTS {
+		nextRetryAt := now.Add(delegateRetryDelay(record.Attempts))
+		record.NextRetryAt = &nextRetryAt
+	}
+}
+
+func (s *Store) RecordDelegateFetch(cycle int64, delegate tezos.Address, fetchErr error) error {
+	record := common.StoredDelegateFetch{
+		Cycle:    cycle,
+		Delegate: common.Address{Address: delegate},
+	}
+	if err := s.db.Model(&common.StoredDelegateFetch{}).Where("cycle = ? AND delegate = ?", cycle, common.Address{Address: delegate}).First(&record).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	applyDelegateFetchResult(&record, fetchErr, time.Now())
+	return s.db.Save(&record).Error
+}
+
+// failed delegate fetches which are due for retry, oldest cycles first
+func (s *Store) GetDelegateFetchesToRetry(limit int) ([]common.StoredDelegateFetch, error) {
+	var records []common.StoredDelegateFetch
+	if err := s.db.Model(&common.StoredDelegateFetch{}).
+		Where("status = ? AND next_retry_at IS NOT NULL AND next_retry_at <= ?", common.DelegateFetchStatusFailed, time.Now()).
+		Order("cycle asc").Limit(limit).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *Store) GetCycleFetch(cycle int64) (*StoredCycleFetch, error) {
+	var cycleFetch StoredCycleFetch
+	if err := s.db.Model(&StoredCycleFetch{}).Where("cycle = ?", cycle).First(&cycleFetch).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+	return &cycleFetch, nil
+}
+
+func (s *Store) GetCycleFetchStatus(cycle int64) (*common.CycleFetchStatus, error) {
+	cycleFetch, err := s.GetCycleFetch(cycle)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []common.StoredDelegateFetch
+	if err := s.db.Model(&common.StoredDelegateFetch{}).Where("cycle = ?", cycle).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return summarizeCycleFetch(cycleFetch, records), nil
+}
+
+func summarizeCycleFetch(cycleFetch *StoredCycleFetch, records []common.StoredDelegateFetch) *common.CycleFetchStatus {
+	result := &common.CycleFetchStatus{
+		Cycle:          cycleFetch.Cycle,
+		LastBlockLevel: cycleFetch.LastBlockLevel,
+		Finished:       cycleFetch.Finished,
+		Expected:       cycleFetch.DelegatesCount,
+		StartedAt:      cycleFetch.StartedAt,
+		FinishedAt:     cycleFetch.FinishedAt,
+		Failures:       []common.StoredDelegateFetch{},
+	}
+	for _, record := range records {
+		switch record.Status {
+		case common.DelegateFetchStatusSucceeded:
+			result.Succeeded++
+		case common.DelegateFetchStatusFailed:
+			result.Failed++
+			result.Failures = append(result.Failures, record)
+		default:
+			result.Pending++
+		}
+	}
+	result.Complete = result.Finished && result.Succeeded >= result.Expected
+	return result
+}
+
+func (s *Store) GetSucceededDelegates(cycle int64) ([]tezos.Address, error) {
+	var records []common.StoredDelegateFetch
+	if err := s.db.Model(&common.StoredDelegateFetch{}).Where("cycle = ? AND status = ?", cycle, common.DelegateFetchStatusSucceeded).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return lo.Map(records, func(record common.StoredDelegateFetch, _ int) tezos.Address {
+		return record.Delegate.Address
+	}), nil
+}
+
+// cycle fetches within the given cycles which were interrupted or invalidated, oldest first
+func (s *Store) GetUnfinishedCycleFetches(fromCycle, toCycle int64) ([]StoredCycleFetch, error) {
+	var cycleFetches []StoredCycleFetch
+	if err := s.db.Model(&StoredCycleFetch{}).Where("finished = ? AND cycle >= ? AND cycle <= ?", false, fromCycle, toCycle).Order("cycle asc").Find(&cycleFetches).Error; err != nil {
+		return nil, err
+	}
+	return cycleFetches, nil
+}
+
+func (s *Store) GetLastFinishedCycle() (int64, error) {
+	var cycle int64
+
+	if err := s.db.Model(&StoredCycleFetch{}).Select("cycle").Where("finished = ?", true).Order("cycle desc").First(&cycle).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return cycle, nil
+}
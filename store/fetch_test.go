@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestDelegateRetryDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	base := constants.DELEGATE_RETRY_BASE_DELAY_MINUTES * time.Minute
+	assert.Equal(base, delegateRetryDelay(1))
+	assert.Equal(2*base, delegateRetryDelay(2))
+	assert.Equal(8*base, delegateRetryDelay(4))
+	assert.Equal(constants.DELEGATE_RETRY_MAX_DELAY_MINUTES*time.Minute, delegateRetryDelay(100))
+}
+
+func TestStartCycleFetchKeepsFinishedCycle(t *testing.T) {
+	assert := assert.New(t)
+	store := newTestStore(t)
+
+	delegates := []tezos.Address{tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")}
+	assert.Nil(store.StartCycleFetch(745, 5799936, delegates))
+	assert.Nil(store.RecordDelegateFetch(745, delegates[0], nil))
+	assert.Nil(store.FinishCycleFetch(745))
+
+	// forced refetch of the same cycle
+	assert.Nil(store.StartCycleFetch(745, 5799936, delegates))
+	cycleFetch, err := store.GetCycleFetch(745)
+	assert.Nil(err)
+	assert.True(cycleFetch.Finished)
+	lastFetchedCycle, err := store.GetLastFetchedCycle()
+	assert.Nil(err)
+	assert.Equal(int64(745), lastFetchedCycle)
+}
+
+func TestApplyDelegateFetchResult(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	record := common.StoredDelegateFetch{Status: common.DelegateFetchStatusPending}
+	applyDelegateFetchResult(&record, nil, now)
+	assert.Equal(common.DelegateFetchStatusSucceeded, record.Status)
+	assert.Equal(0, record.Attempts)
+	assert.Nil(record.NextRetryAt)
+
+	applyDelegateFetchResult(&record, errors.New("rpc unavailable"), now)
+	assert.Equal(common.DelegateFetchStatusFailed, record.Status)
+	assert.Equal(1, record.Attempts)
+	assert.Equal("rpc unavailable", record.Error)
+	assert.Equal(now.Add(delegateRetryDelay(1)), *record.NextRetryAt)
+
+	// successful retry clears the error but keeps the failed attempts
+	applyDelegateFetchResult(&record, nil, now)
+	assert.Equal(common.DelegateFetchStatusSucceeded, record.Status)
+	assert.Equal(1, record.Attempts)
+	assert.Empty(record.Error)
+	assert.Nil(record.NextRetryAt)
+
+	// no further retries once the delegate failed too many times
+	record = common.StoredDelegateFetch{Attempts: constants.DELEGATE_RETRY_MAX_ATTEMPTS - 1}
+	applyDelegateFetchResult(&record, errors.New("rpc unavailable"), now)
+	assert.Equal(constants.DELEGATE_RETRY_MAX_ATTEMPTS, record.Attempts)
+	assert.Nil(record.NextRetryAt)
+}
+
+func TestSummarizeCycleFetch(t *testing.T) {
+	assert := assert.New(t)
+
+	failed := common.StoredDelegateFetch{Cycle: 745, Status: common.DelegateFetchStatusFailed, Error: "rpc unavailable"}
+	records := []common.StoredDelegateFetch{
+		{Cycle: 745, Status: common.DelegateFetchStatusSucceeded},
+		{Cycle: 745, Status: common.DelegateFetchStatusPending},
+		failed,
+	}
+	status := summarizeCycleFetch(&StoredCycleFetch{Cycle: 745, LastBlockLevel: 5799936, DelegatesCount: 3, Finished: true}, records)
+	assert.Equal(int64(745), status.Cycle)
+	assert.Equal(int64(5799936), status.LastBlockLevel)
+	assert.Equal(3, status.Expected)
+	assert.Equal(1, status.Succeeded)
+	assert.Equal(1, status.Pending)
+	assert.Equal(1, status.Failed)
+	assert.Equal([]common.StoredDelegateFetch{failed}, status.Failures)
+	assert.False(status.Complete)
+
+	status = summarizeCycleFetch(&StoredCycleFetch{Cycle: 745, DelegatesCount: 1, Finished: true}, records[:1])
+	assert.True(status.Complete)
+	assert.Empty(status.Failures)
+}
+
+func TestGetDelegateFetchesToRetry(t *testing.T) {
+	assert := assert.New(t)
+	store := newTestStore(t)
+
+	due := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	notDue := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	exhausted := tezos.MustParseAddress("tz1gXWW1q8NcXtVy2oVVcc2s4XKNzv9CryWd")
+	succeeded := tezos.MustParseAddress("tz1aKxnrzx5PXZJe7unufEswVRCMU9yafmfb")
+
+	past := time.Now().Add(-time.Minute)
+	assert.Nil(store.db.Create([]common.StoredDelegateFetch{
+		{Cycle: 746, Delegate: common.Address{Address: due}, Status: common.DelegateFetchStatusFailed, Attempts: 1, NextRetryAt: &past},
+		{Cycle: 745, Delegate: common.Address{Address: due}, Status: common.DelegateFetchStatusFailed, Attempts: 2, NextRetryAt: &past},
+		{Cycle: 745, Delegate: common.Address{Address: succeeded}, Status: common.DelegateFetchStatusSucceeded, Attempts: 1},
+	}).Error)
+	assert.Nil(store.RecordDelegateFetch(745, notDue, errors.New("rpc unavailable")))
+	for range constants.DELEGATE_RETRY_MAX_ATTEMPTS {
+		assert.Nil(store.RecordDelegateFetch(745, exhausted, errors.New("rpc unavailable")))
+	}
+
+	records, err := store.GetDelegateFetchesToRetry(10)
+	assert.Nil(err)
+	assert.Len(records, 2)
+	for i, cycle := range []int64{745, 746} {
+		assert.Equal(cycle, records[i].Cycle)
+		assert.Equal(due, records[i].Delegate.Address)
+	}
+
+	records, err = store.GetDelegateFetchesToRetry(1)
+	assert.Nil(err)
+	assert.Len(records, 1)
+}
+
+func TestInvalidatedCycleFetchResumes(t *testing.T) {
+	assert := assert.New(t)
+	store := newTestStore(t)
+
+	cycle := int64(745)
+	delegates := []tezos.Address{
+		tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM"),
+		tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx"),
+	}
+	assert.Nil(store.StartCycleFetch(cycle, 5799936, delegates))
+	for _, delegate := range delegates {
+		assert.Nil(store.StoreDelegationState(&common.StoredDelegationState{
+			Delegate:       common.Address{Address: delegate},
+			Cycle:          cycle,
+			LastBlockLevel: 5799936,
+			LastBlockHash:  "BLorphaned",
+		}, common.DelegationStateVersionReasonFetch))
+		assert.Nil(store.RecordDelegateFetch(cycle, delegate, nil))
+	}
+	assert.Nil(store.FinishCycleFetch(cycle))
+
+	assert.Nil(store.InvalidateDelegationStates(cycle, "BLorphaned"))
+	succeeded, err := store.GetSucceededDelegates(cycle)
+	assert.Nil(err)
+	assert.Empty(succeeded)
+	unfinished, err := store.GetUnfinishedCycleFetches(cycle, cycle)
+	assert.Nil(err)
+	assert.Len(unfinished, 1)
+	assert.Equal(int64(5799936), unfinished[0].LastBlockLevel)
+
+	// refetch interrupted after the first delegate
+	assert.Nil(store.StartCycleFetch(cycle, 5799936, delegates))
+	assert.Nil(store.RecordDelegateFetch(cycle, delegates[0], nil))
+	succeeded, err = store.GetSucceededDelegates(cycle)
+	assert.Nil(err)
+	assert.Equal(delegates[:1], succeeded)
+	unfinished, err = store.GetUnfinishedCycleFetches(cycle, cycle)
+	assert.Nil(err)
+	assert.Len(unfinished, 1)
+
+	// resumed fetch completes the remaining delegate
+	assert.Nil(store.StartCycleFetch(cycle, 5799936, delegates))
+	assert.Nil(store.RecordDelegateFetch(cycle, delegates[1], nil))
+	assert.Nil(store.FinishCycleFetch(cycle))
+	unfinished, err = store.GetUnfinishedCycleFetches(cycle, cycle)
+	assert.Nil(err)
+	assert.Empty(unfinished)
+	status, err := store.GetCycleFetchStatus(cycle)
+	assert.Nil(err)
+	assert.True(status.Complete)
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+)
+
+// staker which requested unstake from the baker, cleared level is set once all its unstaked deposits are gone
+type StoredUnstakeCandidate struct {
+	Baker         common.Address `json:"baker" gorm:"primaryKey"`
+	Staker        common.Address `json:"staker" gorm:"primaryKey"`
+	FirstLevel    int64          `json:"first_level" gorm:"index"`
+	PendingAmount int64          `json:"pending_amount"`
+	ClearedLevel  *int64         `json:"cleared_level,omitempty"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+type StoredIndexerState struct {
+	Name              string    `json:"name" gorm:"primaryKey"`
+	FirstIndexedLevel int64     `json:"first_indexed_level"`
+	LastIndexedLevel  int64     `json:"last_indexed_level"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// change of unstaked deposits of the staker held by the baker
+type UnstakeChange struct {
+	Baker  tezos.Address
+	Staker tezos.Address
+	Amount int64
+}
+
+func (s *Store) GetIndexerState(name string) (*StoredIndexerState, error) {
+	var state StoredIndexerState
+	if err := s.db.Model(&StoredIndexerState{}).Where("name = ?", name).First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+// applies unstake changes of a single block and moves the indexer to its level
+func (s *Store) ApplyUnstakeChanges(name string, level int64, changes []UnstakeChange) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			candidate := StoredUnstakeCandidate{
+				Baker:      common.Address{Address: change.Baker},
+				Staker:     common.Address{Address: change.Staker},
+				FirstLevel: level,
+			}
+			if err := tx.Model(&StoredUnstakeCandidate{}).Where("baker = ? AND staker = ?", common.Address{Address: change.Baker}, common.Address{Address: change.Staker}).First(&candidate).Error; err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+
+			candidate.PendingAmount += change.Amount
+			candidate.ClearedLevel = nil
+			if candidate.PendingAmount <= 0 {
+				candidate.PendingAmount = 0
+				candidate.ClearedLevel = &level
+			}
+			if err := tx.Save(&candidate).Error; err != nil {
+				return err
+			}
+		}
+
+		state := StoredIndexerState{
+			Name:              name,
+			FirstIndexedLevel: level,
+		}
+		if err := tx.Model(&StoredIndexerState{}).Where("name = ?", name).First(&state).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		state.LastIndexedLevel = level
+		return tx.Save(&state).Error
+	})
+}
+
+// stakers of the baker with unstake requests pending at the level, the baker itself is excluded
+func (s *Store) GetUnstakeCandidates(baker tezos.Address, level int64) ([]tezos.Address, error) {
+	var candidates []StoredUnstakeCandidate
+	slog.Debug("loading unstake candidates", "baker", baker.String(), "level", level)
+	if err := s.db.Model(&StoredUnstakeCandidate{}).
+		Where("baker = ? AND staker <> ? AND first_level <= ? AND (cleared_level IS NULL OR cleared_level >= ?)", common.Address{Address: baker}, common.Address{Address: baker}, level, level).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	return lo.Map(candidates, func(candidate StoredUnstakeCandidate, _ int) tezos.Address {
+		return candidate.Staker.Address
+	}), nil
+}
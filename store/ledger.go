@@ -0,0 +1,144 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+)
+
+func unstakeRequestKey(staker tezos.Address, cycle int64) string {
+	return fmt.Sprintf("%s/%d", staker, cycle)
+}
+
+// merges the ledger entries of the cycle into the known unfinalized requests of the baker,
+// known requests which are not reported anymore were finalized in the cycle
+func buildStakerLedger(cycle int64, baker tezos.Address, entries []common.StakerLedgerEntry, known []common.StoredUnstakeRequest) ([]common.StoredStakerBalance, []common.StoredUnstakeRequest) {
+	requests := make(map[string]*common.StoredUnstakeRequest, len(known))
+	for _, request := range known {
+		if request.FinalizedCycle != nil && *request.FinalizedCycle == cycle {
+			request.FinalizedCycle = nil // cycle is recorded again
+		}
+		requests[unstakeRequestKey(request.Staker.Address, request.Cycle)] = &request
+	}
+
+	balances := make(map[tezos.Address]*common.StoredStakerBalance, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		balance := &common.StoredStakerBalance{
+			Staker:        common.Address{Address: entry.Staker},
+			Baker:         common.Address{Address: baker},
+			Cycle:         cycle,
+			StakedBalance: entry.StakedBalance,
+		}
+		balances[entry.Staker] = balance
+
+		for _, reported := range entry.Requests {
+			if reported.Finalizable {
+				balance.FinalizableBalance = balance.FinalizableBalance.Add(reported.Amount)
+			} else {
+				balance.PendingBalance = balance.PendingBalance.Add(reported.Amount)
+			}
+
+			key := unstakeRequestKey(entry.Staker, reported.Cycle)
+			seen[key] = true
+			request, ok := requests[key]
+			if !ok {
+				request = &common.StoredUnstakeRequest{
+					Staker:         common.Address{Address: entry.Staker},
+					Baker:          common.Address{Address: baker},
+					Cycle:          reported.Cycle,
+					FirstSeenCycle: cycle,
+				}
+				requests[key] = request
+			}
+			if cycle >= request.LastSeenCycle { // latest report wins
+				request.Amount = reported.Amount
+				request.LastSeenCycle = cycle
+			}
+			request.FirstSeenCycle = min(request.FirstSeenCycle, cycle)
+			if reported.Finalizable && (request.FinalizableCycle == nil || *request.FinalizableCycle > cycle) {
+				finalizableCycle := cycle
+				request.FinalizableCycle = &finalizableCycle
+			}
+		}
+	}
+
+	for key, request := range requests {
+		if seen[key] || request.FinalizedCycle != nil || request.LastSeenCycle >= cycle {
+			continue
+		}
+		finalizedCycle := cycle
+		request.FinalizedCycle = &finalizedCycle
+
+		balance, ok := balances[request.Staker.Address]
+		if !ok {
+			balance = &common.StoredStakerBalance{Staker: request.Staker, Baker: common.Address{Address: baker}, Cycle: cycle}
+			balances[request.Staker.Address] = balance
+		}
+		balance.FinalizedBalance = balance.FinalizedBalance.Add(request.Amount)
+	}
+
+	resultBalances := make([]common.StoredStakerBalance, 0, len(balances))
+	for _, balance := range balances {
+		resultBalances = append(resultBalances, *balance)
+	}
+	slices.SortFunc(resultBalances, func(a, b common.StoredStakerBalance) int {
+		return strings.Compare(a.Staker.String(), b.Staker.String())
+	})
+
+	resultRequests := make([]common.StoredUnstakeRequest, 0, len(requests))
+	for _, request := range requests {
+		resultRequests = append(resultRequests, *request)
+	}
+	slices.SortFunc(resultRequests, func(a, b common.StoredUnstakeRequest) int {
+		if c := strings.Compare(a.Staker.String(), b.Staker.String()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Cycle, b.Cycle)
+	})
+	return resultBalances, resultRequests
+}
+
+// records the stakers of the baker in the cycle, balances of a refetched cycle are replaced
+func (s *Store) RecordStakerLedger(cycle int64, baker tezos.Address, entries []common.StakerLedgerEntry) error {
+	slog.Debug("recording staker ledger", "baker", baker.String(), "cycle", cycle, "stakers", len(entries))
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var known []common.StoredUnstakeRequest
+		if err := tx.Model(&common.StoredUnstakeRequest{}).Where("baker = ? AND (finalized_cycle IS NULL OR finalized_cycle = ?)", common.Address{Address: baker}, cycle).Find(&known).Error; err != nil {
+			return err
+		}
+
+		balances, requests := buildStakerLedger(cycle, baker, entries, known)
+		if err := tx.Where("baker = ? AND cycle = ?", common.Address{Address: baker}, cycle).Delete(&common.StoredStakerBalance{}).Error; err != nil {
+			return err
+		}
+		if len(balances) > 0 {
+			if err := tx.Create(&balances).Error; err != nil {
+				return err
+			}
+		}
+		for _, request := range requests {
+			if err := tx.Save(&request).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) GetStakerLedger(staker tezos.Address) (*common.StakerLedger, error) {
+	result := &common.StakerLedger{Staker: staker}
+	if err := s.db.Model(&common.StoredStakerBalance{}).Where("staker = ?", common.Address{Address: staker}).Order("cycle asc, baker asc").Find(&result.Balances).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&common.StoredUnstakeRequest{}).Where("staker = ?", common.Address{Address: staker}).Order("cycle asc, baker asc").Find(&result.UnstakeRequests).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
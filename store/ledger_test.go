@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestBuildStakerLedger(t *testing.T) {
+	assert := assert.New(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	staker := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	leaving := tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+
+	balances, requests := buildStakerLedger(750, baker, []common.StakerLedgerEntry{
+		{Staker: staker, StakedBalance: common.NewMutez(1000), Requests: []common.StakerUnstakeRequest{
+			{Cycle: 745, Amount: common.NewMutez(100), Finalizable: true},
+			{Cycle: 749, Amount: common.NewMutez(50)},
+		}},
+		{Staker: leaving, Requests: []common.StakerUnstakeRequest{
+			{Cycle: 750, Amount: common.NewMutez(300)},
+		}},
+	}, nil)
+	assert.Equal([]common.StoredStakerBalance{
+		{Staker: common.Address{Address: leaving}, Baker: common.Address{Address: baker}, Cycle: 750, PendingBalance: common.NewMutez(300)},
+		{Staker: common.Address{Address: staker}, Baker: common.Address{Address: baker}, Cycle: 750, StakedBalance: common.NewMutez(1000), FinalizableBalance: common.NewMutez(100), PendingBalance: common.NewMutez(50)},
+	}, balances)
+	assert.Len(requests, 3)
+	assert.Equal(int64(750), *requests[1].FinalizableCycle)
+	assert.Nil(requests[2].FinalizableCycle)
+
+	// the finalizable request of the staker was finalized, the request of the leaving staker became finalizable
+	balances, requests = buildStakerLedger(751, baker, []common.StakerLedgerEntry{
+		{Staker: staker, StakedBalance: common.NewMutez(1000), Requests: []common.StakerUnstakeRequest{
+			{Cycle: 749, Amount: common.NewMutez(50)},
+		}},
+		{Staker: leaving, Requests: []common.StakerUnstakeRequest{
+			{Cycle: 750, Amount: common.NewMutez(300), Finalizable: true},
+		}},
+	}, requests)
+	assert.Equal(common.NewMutez(100), balances[1].FinalizedBalance)
+	assert.Equal(common.NewMutez(300), balances[0].FinalizableBalance)
+	assert.Equal(int64(751), *requests[0].FinalizableCycle)
+	assert.Equal(int64(751), *requests[1].FinalizedCycle)
+	assert.Equal(int64(750), requests[1].LastSeenCycle)
+	assert.Nil(requests[2].FinalizedCycle)
+
+	// stakers without any stake left are kept in the ledger with their finalized amount
+	entries := []common.StakerLedgerEntry{
+		{Staker: staker, StakedBalance: common.NewMutez(1000), Requests: []common.StakerUnstakeRequest{
+			{Cycle: 749, Amount: common.NewMutez(50)},
+		}},
+	}
+	balances, requests = buildStakerLedger(752, baker, entries, []common.StoredUnstakeRequest{requests[0], requests[2]}) // finalized requests are not loaded again
+	assert.Equal(common.StoredStakerBalance{Staker: common.Address{Address: leaving}, Baker: common.Address{Address: baker}, Cycle: 752, FinalizedBalance: common.NewMutez(300)}, balances[0])
+	assert.Equal(int64(752), *requests[0].FinalizedCycle)
+
+	// recording the same cycle again does not finalize the request twice
+	balances, _ = buildStakerLedger(752, baker, entries, requests)
+	assert.Equal(common.NewMutez(300), balances[0].FinalizedBalance)
+	assert.Len(balances, 2)
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/configuration"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// sha256 of the up script, applied scripts must not change
+	Checksum string
+}
+
+// applied migration, the table is managed by the migrations themselves not by gorm
+type StoredSchemaVersion struct {
+	Version   int64     `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func (StoredSchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+	version bigint NOT NULL,
+	name text,
+	checksum text,
+	applied_at timestamptz,
+	PRIMARY KEY (version)
+)`
+
+type SchemaStatus struct {
+	// version of the database schema, 0 for an empty database
+	Current int64 `json:"current"`
+	// latest migration known to the binary
+	Latest  int64                 `json:"latest"`
+	Applied []StoredSchemaVersion `json:"applied"`
+}
+
+func (s *SchemaStatus) Pending() bool {
+	return s.Current < s.Latest
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.Join(constants.ErrInvalidMigration, fmt.Errorf("unexpected file name %s", entry.Name()))
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Join(constants.ErrInvalidMigration, err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, errors.Join(constants.ErrInvalidMigration, fmt.Errorf("migration %d has scripts with different names %s and %s", version, m.Name, match[2]))
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+			checksum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(checksum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Join(constants.ErrInvalidMigration, fmt.Errorf("migration %d needs both up and down script", m.Version))
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return int(a.Version - b.Version) })
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			return nil, errors.Join(constants.ErrInvalidMigration, fmt.Errorf("expected migration %d, got %d", i+1, m.Version))
+		}
+	}
+	return migrations, nil
+}
+
+func latestMigrationVersion(migrations []migration) int64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// refuses invalid versions, schemas newer than the binary and applied migrations which were modified afterwards
+func verifyAppliedMigrations(migrations []migration, applied []StoredSchemaVersion) error {
+	latest := latestMigrationVersion(migrations)
+	for _, version := range applied {
+		if version.Version <= 0 {
+			return errors.Join(constants.ErrInvalidMigration, fmt.Errorf("applied migration has invalid version %d", version.Version))
+		}
+		if version.Version > latest {
+			return errors.Join(constants.ErrSchemaNewerThanBinary, fmt.Errorf("database is at version %d, binary supports up to %d", version.Version, latest))
+		}
+		m := migrations[version.Version-1]
+		if m.Checksum != version.Checksum {
+			return errors.Join(constants.ErrMigrationChecksumMismatch, fmt.Errorf("migration %d_%s was modified after it was applied", m.Version, m.Name))
+		}
+	}
+	return nil
+}
+
+// migrations to run in order, up scripts when target is above current, down scripts otherwise
+func planMigrations(migrations []migration, current, target int64) (up bool, steps []migration, err error) {
+	latest := latestMigrationVersion(migrations)
+	if target < 0 || target > latest {
+		return false, nil, errors.Join(constants.ErrUnknownMigrationTarget, fmt.Errorf("target %d is not within 0 and %d", target, latest))
+	}
+	if target >= current {
+		return true, migrations[current:target], nil
+	}
+	steps = slices.Clone(migrations[target:current])
+	slices.Reverse(steps)
+	return false, steps, nil
+}
+
+type migrator struct {
+	db         *gorm.DB
+	migrations []migration
+}
+
+func newMigrator(db *gorm.DB) (*migrator, error) {
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *migrator) status() (*SchemaStatus, error) {
+	if err := m.db.Exec(schemaVersionTable).Error; err != nil {
+		return nil, err
+	}
+
+	applied := []StoredSchemaVersion{}
+	if err := m.db.Model(&StoredSchemaVersion{}).Order("version asc").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	if err := verifyAppliedMigrations(m.migrations, applied); err != nil {
+		return nil, err
+	}
+
+	status := &SchemaStatus{
+		Latest:  latestMigrationVersion(m.migrations),
+		Applied: applied,
+	}
+	if len(applied) > 0 {
+		status.Current = applied[len(applied)-1].Version
+	}
+	return status, nil
+}
+
+// held while migrating, concurrently started migrations wait for each other
+const migrationLockKey int64 = 0x70726f746f636f6c
+
+// session level lock, the whole migration runs on a single connection
+func (m *migrator) migrate(target int64) (status *SchemaStatus, err error) {
+	err = m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				slog.Warn("failed to release migration lock", "error", err.Error())
+			}
+		}()
+
+		locked := &migrator{db: conn, migrations: m.migrations}
+		status, err = locked.migrateLocked(target)
+		return err
+	})
+	return status, err
+}
+
+func (m *migrator) migrateLocked(target int64) (*SchemaStatus, error) {
+	// read again under the lock, a concurrent migration may have finished meanwhile
+	status, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+	up, steps, err := planMigrations(m.migrations, status.Current, target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		slog.Info("applying migration", "version", step.Version, "name", step.Name, "up", up)
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if !up {
+				if err := tx.Exec(step.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&StoredSchemaVersion{}, step.Version).Error
+			}
+			if err := tx.Exec(step.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&StoredSchemaVersion{
+				Version:   step.Version,
+				Name:      step.Name,
+				Checksum:  step.Checksum,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s failed: %w", step.Version, step.Name, err)
+		}
+	}
+	return m.status()
+}
+
+// up and down move by all pending migrations and by one migration respectively
+func resolveMigrationTarget(status *SchemaStatus, target string) (int64, error) {
+	switch target {
+	case constants.MIGRATE_UP:
+		return status.Latest, nil
+	case constants.MIGRATE_DOWN:
+		return max(status.Current-1, 0), nil
+	case constants.MIGRATE_STATUS:
+		return status.Current, nil
+	}
+	version, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return 0, errors.Join(constants.ErrUnknownMigrationTarget, err)
+	}
+	return version, nil
+}
+
+// moves the database schema to the target, see resolveMigrationTarget, and reports the resulting schema
+func Migrate(config *configuration.Runtime, target string) (*SchemaStatus, error) {
+	db, err := openDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	status, err := migrator.status()
+	if err != nil {
+		return nil, err
+	}
+	version, err := resolveMigrationTarget(status, target)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.migrate(version)
+}
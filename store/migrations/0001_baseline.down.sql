@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS stored_delegation_state_versions;
+DROP TABLE IF EXISTS stored_fetch_audits;
+DROP TABLE IF EXISTS stored_unstake_requests;
+DROP TABLE IF EXISTS stored_staker_balances;
+DROP TABLE IF EXISTS stored_snapshot_imports;
+DROP TABLE IF EXISTS stored_indexer_states;
+DROP TABLE IF EXISTS stored_unstake_candidates;
+DROP TABLE IF EXISTS stored_delegate_fetches;
+DROP TABLE IF EXISTS stored_cycle_fetches;
+DROP TABLE IF EXISTS stored_network_statistics;
+DROP TABLE IF EXISTS stored_delegation_states;
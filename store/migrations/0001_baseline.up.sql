@@ -0,0 +1,136 @@
+-- schema previously created by gorm AutoMigrate, existing databases adopt it unchanged
+
+CREATE TABLE IF NOT EXISTS stored_delegation_states (
+	delegate text NOT NULL,
+	cycle bigint NOT NULL,
+	status bigint,
+	balances jsonb DEFAULT '{}',
+	PRIMARY KEY (delegate, cycle)
+);
+-- columns added to the delegation states after their introduction
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS status_reason text;
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS minimum_search_strategy text;
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS minimum_residual numeric DEFAULT '0';
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS staking_parameters jsonb DEFAULT '{}';
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS created_at jsonb DEFAULT '{}';
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS last_block_level bigint;
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS last_block_hash text;
+ALTER TABLE stored_delegation_states ADD COLUMN IF NOT EXISTS version bigint;
+CREATE INDEX IF NOT EXISTS idx_stored_delegation_states_last_block_hash ON stored_delegation_states (last_block_hash);
+
+CREATE TABLE IF NOT EXISTS stored_network_statistics (
+	cycle bigserial,
+	statistics jsonb DEFAULT '{}',
+	updated_at timestamptz,
+	PRIMARY KEY (cycle)
+);
+
+CREATE TABLE IF NOT EXISTS stored_cycle_fetches (
+	cycle bigserial,
+	last_block_level bigint,
+	delegates_count bigint,
+	finished boolean,
+	started_at timestamptz,
+	finished_at timestamptz,
+	PRIMARY KEY (cycle)
+);
+
+CREATE TABLE IF NOT EXISTS stored_delegate_fetches (
+	cycle bigint NOT NULL,
+	delegate text NOT NULL,
+	status text,
+	error text,
+	attempts bigint,
+	next_retry_at timestamptz,
+	updated_at timestamptz,
+	PRIMARY KEY (cycle, delegate)
+);
+CREATE INDEX IF NOT EXISTS idx_stored_delegate_fetches_status ON stored_delegate_fetches (status);
+
+CREATE TABLE IF NOT EXISTS stored_unstake_candidates (
+	baker text NOT NULL,
+	staker text NOT NULL,
+	first_level bigint,
+	pending_amount bigint,
+	cleared_level bigint,
+	updated_at timestamptz,
+	PRIMARY KEY (baker, staker)
+);
+CREATE INDEX IF NOT EXISTS idx_stored_unstake_candidates_first_level ON stored_unstake_candidates (first_level);
+
+CREATE TABLE IF NOT EXISTS stored_indexer_states (
+	name text NOT NULL,
+	first_indexed_level bigint,
+	last_indexed_level bigint,
+	updated_at timestamptz,
+	PRIMARY KEY (name)
+);
+
+CREATE TABLE IF NOT EXISTS stored_snapshot_imports (
+	delegate text NOT NULL,
+	cycle bigint NOT NULL,
+	protocol text,
+	last_block_level bigint,
+	last_block_hash text,
+	consensus_rights_delay bigint,
+	signer text,
+	imported_at timestamptz,
+	PRIMARY KEY (delegate, cycle)
+);
+CREATE INDEX IF NOT EXISTS idx_stored_snapshot_imports_imported_at ON stored_snapshot_imports (imported_at);
+
+CREATE TABLE IF NOT EXISTS stored_staker_balances (
+	staker text NOT NULL,
+	baker text NOT NULL,
+	cycle bigint NOT NULL,
+	staked_balance numeric DEFAULT '0',
+	finalizable_balance numeric DEFAULT '0',
+	pending_balance numeric DEFAULT '0',
+	finalized_balance numeric DEFAULT '0',
+	PRIMARY KEY (staker, baker, cycle)
+);
+
+CREATE TABLE IF NOT EXISTS stored_unstake_requests (
+	staker text NOT NULL,
+	baker text NOT NULL,
+	cycle bigint NOT NULL,
+	amount numeric DEFAULT '0',
+	first_seen_cycle bigint,
+	last_seen_cycle bigint,
+	finalizable_cycle bigint,
+	finalized_cycle bigint,
+	PRIMARY KEY (staker, baker, cycle)
+);
+CREATE INDEX IF NOT EXISTS idx_stored_unstake_requests_finalized_cycle ON stored_unstake_requests (finalized_cycle);
+
+CREATE TABLE IF NOT EXISTS stored_fetch_audits (
+	id bigserial,
+	delegate text,
+	cycle bigint,
+	options jsonb DEFAULT '{}',
+	providers jsonb DEFAULT '[]',
+	started_at timestamptz,
+	duration_ms bigint,
+	status bigint,
+	contracts_count bigint,
+	created_at jsonb DEFAULT '{}',
+	balances_hash text,
+	version bigint,
+	error text,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_fetch_audit_delegate_cycle ON stored_fetch_audits (delegate, cycle);
+
+CREATE TABLE IF NOT EXISTS stored_delegation_state_versions (
+	delegate text NOT NULL,
+	cycle bigint NOT NULL,
+	version bigint NOT NULL,
+	is_current boolean,
+	reason text,
+	stored_at timestamptz,
+	status bigint,
+	balances_hash text,
+	state jsonb DEFAULT '{}',
+	PRIMARY KEY (delegate, cycle, version)
+);
+CREATE INDEX IF NOT EXISTS idx_stored_delegation_state_versions_current ON stored_delegation_state_versions (is_current);
@@ -0,0 +1 @@
+-- backfilled versions are kept, applying the migration again skips states which already have versions
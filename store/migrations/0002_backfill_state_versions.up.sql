@@ -0,0 +1,22 @@
+-- states stored before versioning become version 1, balances_hash matches DelegatedBalances.Hash, balances missing in legacy states count as 0
+INSERT INTO stored_delegation_state_versions (delegate, cycle, version, is_current, reason, stored_at, status, balances_hash, state)
+SELECT
+	s.delegate,
+	s.cycle,
+	1,
+	true,
+	'unversioned',
+	now(),
+	s.status,
+	encode(sha256(convert_to(coalesce((
+		SELECT string_agg(b.key || ':' || coalesce(b.value->>'delegated_balance', '0') || ':' || coalesce(b.value->>'overstaked_balance', '0') || ':' || coalesce(b.value->>'staked_balance', '0') || E'\n', '' ORDER BY b.key COLLATE "C")
+		FROM jsonb_each(coalesce(s.balances, '{}')) b
+	), ''), 'UTF8')), 'hex'),
+	jsonb_set(to_jsonb(s), '{version}', '1')
+FROM stored_delegation_states s
+WHERE coalesce(s.version, 0) = 0
+	AND NOT EXISTS (SELECT 1 FROM stored_delegation_state_versions v WHERE v.delegate = s.delegate AND v.cycle = s.cycle);
+
+UPDATE stored_delegation_states s SET version = 1
+WHERE coalesce(s.version, 0) = 0
+	AND EXISTS (SELECT 1 FROM stored_delegation_state_versions v WHERE v.delegate = s.delegate AND v.cycle = s.cycle AND v.version = 1 AND v.reason = 'unversioned');
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	assert.Nil(err)
+	assert.NotEmpty(migrations)
+	for i, m := range migrations {
+		assert.Equal(int64(i+1), m.Version)
+		assert.NotEmpty(m.Up)
+		assert.NotEmpty(m.Down)
+		assert.Len(m.Checksum, 64)
+	}
+	assert.Equal("baseline", migrations[0].Name)
+}
+
+// models are no longer auto migrated, every column has to be created by a migration
+func TestMigrationsCoverModels(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	assert.Nil(err)
+	columns := migratedColumns(migrations)
+
+	models := []any{&common.StoredDelegationState{}, &StoredNetworkStatistics{}, &StoredCycleFetch{}, &common.StoredDelegateFetch{}, &StoredUnstakeCandidate{}, &StoredIndexerState{}, &StoredSnapshotImport{}, &common.StoredStakerBalance{}, &common.StoredUnstakeRequest{}, &common.StoredFetchAudit{}, &StoredDelegationStateVersion{}, &StoredSchemaVersion{}}
+	for _, model := range models {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		assert.Nil(err)
+		for _, column := range s.DBNames {
+			assert.True(columns[s.Table][column], s.Table+"."+column)
+		}
+	}
+}
+
+func TestLoadMigrationsRejectsInvalidSets(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := loadMigrations(fstest.MapFS{
+		"m/0001_init.up.sql": {Data: []byte("SELECT 1;")},
+	}, "m")
+	assert.ErrorIs(err, constants.ErrInvalidMigration)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"m/0001_init.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/0001_init.down.sql": {Data: []byte("SELECT 1;")},
+		"m/0003_skip.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/0003_skip.down.sql": {Data: []byte("SELECT 1;")},
+	}, "m")
+	assert.ErrorIs(err, constants.ErrInvalidMigration)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"m/init.sql": {Data: []byte("SELECT 1;")},
+	}, "m")
+	assert.ErrorIs(err, constants.ErrInvalidMigration)
+}
+
+func TestVerifyAppliedMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := loadMigrations(fstest.MapFS{
+		"m/0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id bigint);")},
+		"m/0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+		"m/0002_column.up.sql":   {Data: []byte("ALTER TABLE a ADD COLUMN b text;")},
+		"m/0002_column.down.sql": {Data: []byte("ALTER TABLE a DROP COLUMN b;")},
+	}, "m")
+	assert.Nil(err)
+
+	applied := []StoredSchemaVersion{
+		{Version: 1, Name: "init", Checksum: migrations[0].Checksum},
+		{Version: 2, Name: "column", Checksum: migrations[1].Checksum},
+	}
+	assert.Nil(verifyAppliedMigrations(migrations, applied))
+
+	modified := append([]StoredSchemaVersion{}, applied...)
+	modified[1].Checksum = migrations[0].Checksum
+	assert.ErrorIs(verifyAppliedMigrations(migrations, modified), constants.ErrMigrationChecksumMismatch)
+
+	newer := append(applied, StoredSchemaVersion{Version: 3, Name: "future"})
+	assert.ErrorIs(verifyAppliedMigrations(migrations, newer), constants.ErrSchemaNewerThanBinary)
+	assert.ErrorIs(verifyAppliedMigrations(migrations[:1], applied), constants.ErrSchemaNewerThanBinary)
+
+	for _, version := range []int64{0, -1} {
+		invalid := append([]StoredSchemaVersion{{Version: version, Name: "invalid"}}, applied...)
+		assert.ErrorIs(verifyAppliedMigrations(migrations, invalid), constants.ErrInvalidMigration)
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations := []migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+
+	up, steps, err := planMigrations(migrations, 1, 3)
+	assert.Nil(err)
+	assert.True(up)
+	assert.Equal([]string{"b", "c"}, migrationNames(steps))
+
+	up, steps, err = planMigrations(migrations, 3, 1)
+	assert.Nil(err)
+	assert.False(up)
+	assert.Equal([]string{"c", "b"}, migrationNames(steps))
+
+	_, steps, err = planMigrations(migrations, 2, 2)
+	assert.Nil(err)
+	assert.Empty(steps)
+
+	_, _, err = planMigrations(migrations, 0, 4)
+	assert.ErrorIs(err, constants.ErrUnknownMigrationTarget)
+	_, _, err = planMigrations(migrations, 0, -1)
+	assert.ErrorIs(err, constants.ErrUnknownMigrationTarget)
+}
+
+func TestResolveMigrationTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	status := &SchemaStatus{Current: 1, Latest: 3}
+	for target, expected := range map[string]int64{"up": 3, "down": 0, "status": 1, "2": 2} {
+		version, err := resolveMigrationTarget(status, target)
+		assert.Nil(err)
+		assert.Equal(expected, version, target)
+	}
+
+	version, err := resolveMigrationTarget(&SchemaStatus{}, "down")
+	assert.Nil(err)
+	assert.Equal(int64(0), version)
+
+	_, err = resolveMigrationTarget(status, "latest")
+	assert.ErrorIs(err, constants.ErrUnknownMigrationTarget)
+}
+
+var (
+	createTableStatement = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\s*\)`)
+	addColumnStatement   = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// columns of each table created by the up scripts, including the schema_version table
+func migratedColumns(migrations []migration) map[string]map[string]bool {
+	scripts := []string{schemaVersionTable}
+	for _, m := range migrations {
+		scripts = append(scripts, m.Up)
+	}
+
+	result := map[string]map[string]bool{}
+	add := func(table, column string) {
+		if result[table] == nil {
+			result[table] = map[string]bool{}
+		}
+		result[table][column] = true
+	}
+	for _, script := range scripts {
+		for _, match := range createTableStatement.FindAllStringSubmatch(script, -1) {
+			for _, line := range strings.Split(match[2], "\n") {
+				if fields := strings.Fields(line); len(fields) > 0 && fields[0] != "PRIMARY" {
+					add(match[1], fields[0])
+				}
+			}
+		}
+		for _, match := range addColumnStatement.FindAllStringSubmatch(script, -1) {
+			add(match[1], match[2])
+		}
+	}
+	return result
+}
+
+func migrationNames(migrations []migration) []string {
+	names := make([]string, 0, len(migrations))
+	for _, m := range migrations {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestBackfillStateVersionsHashesLegacyBalances(t *testing.T) {
+	assert := assert.New(t)
+	store := newTestStore(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	delegator := tezos.MustParseAddress("tz1NuAqi3T35CPZV7tQu94wa3urCCzJrV7zc")
+	// stored before overstaked_balance existed and before versioning
+	assert.Nil(store.db.Create(&common.StoredDelegationState{Delegate: common.Address{Address: baker}, Cycle: 745}).Error)
+	legacy := `{"` + baker.String() + `": {"delegated_balance": "1000", "staked_balance": "500"}, "` + delegator.String() + `": {"delegated_balance": "2000"}}`
+	assert.Nil(store.db.Model(&common.StoredDelegationState{}).Where("cycle = ?", 745).Update("balances", gorm.Expr("?::jsonb", legacy)).Error)
+
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	assert.Nil(err)
+	backfill := migrations[1]
+	assert.Equal("backfill_state_versions", backfill.Name)
+	assert.Nil(store.db.Exec(backfill.Up).Error)
+
+	versions, err := store.GetDelegationStateVersions(baker, 745)
+	assert.Nil(err)
+	if assert.Len(versions, 1) {
+		assert.Equal(common.DelegatedBalances{
+			baker:     {DelegatedBalance: common.NewMutez(1000), StakedBalance: common.NewMutez(500)},
+			delegator: {DelegatedBalance: common.NewMutez(2000)},
+		}.Hash(), versions[0].BalancesHash)
+	}
+}
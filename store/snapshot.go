@@ -0,0 +1,54 @@
+package store
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"gorm.io/gorm"
+)
+
+// provenance of a delegation state loaded from a snapshot file
+type StoredSnapshotImport struct {
+	Delegate             common.Address `json:"delegate" gorm:"primaryKey"`
+	Cycle                int64          `json:"cycle" gorm:"primaryKey"`
+	Protocol             string         `json:"protocol"`
+	LastBlockLevel       int64          `json:"last_block_level"`
+	LastBlockHash        string         `json:"last_block_hash"`
+	ConsensusRightsDelay int64          `json:"consensus_rights_delay"`
+	Signer               string         `json:"signer"`
+	ImportedAt           time.Time      `json:"imported_at" gorm:"index"`
+}
+
+// stores the state and its provenance in a single transaction
+func (s *Store) ImportDelegationState(state *common.StoredDelegationState, record *StoredSnapshotImport) error {
+	slog.Debug("importing delegation state", "delegate", state.Delegate.String(), "cycle", state.Cycle)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := storeDelegationStateVersion(tx, state, common.DelegationStateVersionReasonSnapshotImport); err != nil {
+			return err
+		}
+		record.ImportedAt = time.Now()
+		return tx.Save(record).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.RefreshChangedNetworkStatistics(state.Cycle); err != nil {
+		slog.Warn("failed to refresh network statistics", "cycle", state.Cycle, "error", err.Error())
+	}
+	return nil
+}
+
+// most recent import, used to serve the api without rpc access
+func (s *Store) GetLastSnapshotImport() (*StoredSnapshotImport, error) {
+	var record StoredSnapshotImport
+	if err := s.db.Model(&StoredSnapshotImport{}).Order("imported_at desc").First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+)
+
+type NetworkStatisticsData common.NetworkCycleStatistics
+
+func (j NetworkStatisticsData) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *NetworkStatisticsData) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+// precomputed network wide statistics, refreshed after each fetched cycle
+type StoredNetworkStatistics struct {
+	Cycle      int64                 `json:"cycle" gorm:"primaryKey"`
+	Statistics NetworkStatisticsData `json:"statistics" gorm:"type:jsonb;default:'{}'"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+func percentiles(values []common.Mutez) common.Percentiles {
+	if len(values) == 0 {
+		return common.Percentiles{}
+	}
+	sorted := slices.Clone(values)
+	slices.SortFunc(sorted, common.Mutez.Cmp)
+
+	// nearest rank
+	rank := func(p int) common.Mutez {
+		index := (p*len(sorted)+99)/100 - 1
+		return sorted[max(index, 0)]
+	}
+
+	return common.Percentiles{
+		P10: rank(10),
+		P25: rank(25),
+		P50: rank(50),
+		P75: rank(75),
+		P90: rank(90),
+		P99: rank(99),
+	}
+}
+
+func aggregateNetworkStatistics(cycle int64, states []common.StoredDelegationState, previous *common.NetworkCycleStatistics) *common.NetworkCycleStatistics {
+	result := &common.NetworkCycleStatistics{
+		Cycle:                    cycle,
+		DelegatesCount:           len(states),
+		DelegatorsPerBaker:       make(map[tezos.Address]int, len(states)),
+		TopBakersByExternalStake: make([]common.LeaderboardEntry, 0, len(states)),
+	}
+
+	bakingPowers := make([]common.Mutez, 0, len(states))
+	stakedBalances := make([]common.Mutez, 0)
+	for _, state := range states {
+		statistics := state.Statistics()
+
+		result.TotalStaked = common.SumMutez(result.TotalStaked, statistics.OwnStaked, statistics.ExternalStaked)
+		result.TotalDelegated = common.SumMutez(result.TotalDelegated, statistics.OwnDelegated, statistics.ExternalDelegated)
+		result.TotalOverstaked = result.TotalOverstaked.Add(statistics.ExternalOverstaked)
+		result.TotalBakingPower = result.TotalBakingPower.Add(statistics.BakingPower)
+		result.DelegatorsCount += statistics.DelegatorsCount
+		result.DelegatorsPerBaker[state.Delegate.Address] = statistics.DelegatorsCount
+		result.TopBakersByExternalStake = append(result.TopBakersByExternalStake, common.LeaderboardEntry{
+			Delegate:                state.Delegate.Address,
+			DelegateCycleStatistics: statistics,
+		})
+
+		bakingPowers = append(bakingPowers, statistics.BakingPower)
+		for addr, balances := range state.Balances {
+			if addr.Equal(state.Delegate.Address) || balances.StakedBalance.IsZero() {
+				continue
+			}
+			stakedBalances = append(stakedBalances, balances.StakedBalance)
+		}
+	}
+
+	result.BakingPowerPercentiles = percentiles(bakingPowers)
+	result.StakedBalancePercentiles = percentiles(stakedBalances)
+
+	slices.SortFunc(result.TopBakersByExternalStake, func(a, b common.LeaderboardEntry) int {
+		if c := b.ExternalStaked.Cmp(a.ExternalStaked); c != 0 {
+			return c
+		}
+		return b.BakingPower.Cmp(a.BakingPower)
+	})
+	if len(result.TopBakersByExternalStake) > constants.STATISTICS_LEADERBOARD_SIZE {
+		result.TopBakersByExternalStake = result.TopBakersByExternalStake[:constants.STATISTICS_LEADERBOARD_SIZE]
+	}
+
+	if previous != nil {
+		result.Changes = &common.NetworkCycleStatisticsChange{
+			TotalStaked:     result.TotalStaked.Sub(previous.TotalStaked),
+			TotalDelegated:  result.TotalDelegated.Sub(previous.TotalDelegated),
+			TotalOverstaked: result.TotalOverstaked.Sub(previous.TotalOverstaked),
+			DelegatesCount:  result.DelegatesCount - previous.DelegatesCount,
+			DelegatorsCount: result.DelegatorsCount - previous.DelegatorsCount,
+		}
+	}
+
+	return result
+}
+
+func (s *Store) GetNetworkStatistics(cycle int64) (*common.NetworkCycleStatistics, error) {
+	var stored StoredNetworkStatistics
+	if err := s.db.Model(&StoredNetworkStatistics{}).Where("cycle = ?", cycle).First(&stored).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+	result := common.NetworkCycleStatistics(stored.Statistics)
+	return &result, nil
+}
+
+// materialized statistics of the cycles, cycles without them are left out
+func (s *Store) GetNetworkStatisticsOfCycles(cycles []int64) (map[int64]*common.NetworkCycleStatistics, error) {
+	result := make(map[int64]*common.NetworkCycleStatistics, len(cycles))
+	if len(cycles) == 0 {
+		return result, nil
+	}
+
+	var stored []StoredNetworkStatistics
+	if err := s.db.Model(&StoredNetworkStatistics{}).Where("cycle IN ?", cycles).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range stored {
+		statistics := common.NetworkCycleStatistics(record.Statistics)
+		result[record.Cycle] = &statistics
+	}
+	return result, nil
+}
+
+// recomputes network statistics of the cycle from stored delegation states and materializes them
+func (s *Store) RefreshNetworkStatistics(cycle int64) (*common.NetworkCycleStatistics, error) {
+	var states []common.StoredDelegationState
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("cycle = ?", cycle).Find(&states).Error; err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return nil, constants.ErrNotFound
+	}
+
+	previous, err := s.GetNetworkStatistics(cycle - 1)
+	if err != nil && !errors.Is(err, constants.ErrNotFound) {
+		return nil, err
+	}
+
+	result := aggregateNetworkStatistics(cycle, states, previous)
+
+	slog.Debug("storing network statistics", "cycle", cycle)
+	if err := s.db.Save(&StoredNetworkStatistics{
+		Cycle:      cycle,
+		Statistics: NetworkStatisticsData(*result),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cycles with stored states but no materialized statistics, e.g. fetched before statistics were introduced
+func (s *Store) GetCyclesWithoutNetworkStatistics() ([]int64, error) {
+	var cycles []int64
+	if err := s.db.Model(&common.StoredDelegationState{}).Distinct("cycle").Where("cycle NOT IN (?)", s.db.Model(&StoredNetworkStatistics{}).Select("cycle")).Order("cycle asc").Pluck("cycle", &cycles).Error; err != nil {
+		return nil, err
+	}
+	return cycles, nil
+}
+
+// refreshes statistics after states of the cycle changed, the following cycle reports its changes against them
+func (s *Store) RefreshChangedNetworkStatistics(cycle int64) error {
+	for _, cycle := range []int64{cycle, cycle + 1} {
+		if _, err := s.RefreshNetworkStatistics(cycle); err != nil && !errors.Is(err, constants.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/trilitech/tzgo/tezos"
+)
+
+func TestPercentiles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(common.Percentiles{}, percentiles(nil))
+	assert.Equal(common.Percentiles{P10: common.NewMutez(7), P25: common.NewMutez(7), P50: common.NewMutez(7), P75: common.NewMutez(7), P90: common.NewMutez(7), P99: common.NewMutez(7)}, percentiles([]common.Mutez{common.NewMutez(7)}))
+
+	values := make([]common.Mutez, 0, 100)
+	for i := int64(100); i > 0; i-- {
+		values = append(values, common.NewMutez(i))
+	}
+	assert.Equal(common.Percentiles{P10: common.NewMutez(10), P25: common.NewMutez(25), P50: common.NewMutez(50), P75: common.NewMutez(75), P90: common.NewMutez(90), P99: common.NewMutez(99)}, percentiles(values))
+}
+
+func TestAggregateNetworkStatistics(t *testing.T) {
+	assert := assert.New(t)
+
+	bakerA := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	bakerB := tezos.MustParseAddress("tz1S5WxdZR5f9NzsPXhr7L9L1vrEb5spZFur")
+	delegator := tezos.MustParseAddress("tz1P6WKJu2rcbxKiKRZHKQKmKrpC9TfW1AwM")
+	staker := tezos.MustParseAddress("tz1LVqmufjrmV67vNmZWXRDPMwSCh7mLBnS3")
+
+	states := []common.StoredDelegationState{
+		{
+			Delegate: common.Address{Address: bakerA},
+			Cycle:    750,
+			Balances: common.DelegatedBalances{
+				bakerA:    {DelegatedBalance: common.NewMutez(1000), StakedBalance: common.NewMutez(1000)},
+				delegator: {DelegatedBalance: common.NewMutez(500)},
+			},
+		},
+		{
+			Delegate: common.Address{Address: bakerB},
+			Cycle:    750,
+			Balances: common.DelegatedBalances{
+				bakerB: {DelegatedBalance: common.NewMutez(100), StakedBalance: common.NewMutez(100)},
+				staker: {DelegatedBalance: common.NewMutez(10), StakedBalance: common.NewMutez(2000), OverstakedBalance: common.NewMutez(1500)},
+			},
+		},
+	}
+
+	result := aggregateNetworkStatistics(750, states, &common.NetworkCycleStatistics{
+		TotalStaked:     common.NewMutez(3000),
+		DelegatesCount:  1,
+		DelegatorsCount: 2,
+	})
+
+	assert.Equal(2, result.DelegatesCount)
+	assert.Equal(2, result.DelegatorsCount)
+	assert.Equal(common.NewMutez(3100), result.TotalStaked)
+	assert.Equal(common.NewMutez(1610), result.TotalDelegated)
+	assert.Equal(common.NewMutez(1500), result.TotalOverstaked)
+	assert.Equal(common.NewMutez(1750+2155), result.TotalBakingPower)
+	assert.Equal(map[tezos.Address]int{bakerA: 1, bakerB: 1}, result.DelegatorsPerBaker)
+	assert.Equal(bakerB, result.TopBakersByExternalStake[0].Delegate)
+	assert.Equal(bakerA, result.TopBakersByExternalStake[1].Delegate)
+	assert.Equal(common.NewMutez(2000), result.StakedBalancePercentiles.P50)
+	assert.Equal(&common.NetworkCycleStatisticsChange{
+		TotalStaked:     common.NewMutez(100),
+		TotalDelegated:  common.NewMutez(1610),
+		TotalOverstaked: common.NewMutez(1500),
+		DelegatesCount:  1,
+		DelegatorsCount: 0,
+	}, result.Changes)
+}
+
+func TestGetNetworkStatisticsOfCycles(t *testing.T) {
+	assert := assert.New(t)
+	store := newTestStore(t)
+
+	baker := tezos.MustParseAddress("tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx")
+	for _, cycle := range []int64{745, 746} {
+		assert.Nil(store.StoreDelegationState(&common.StoredDelegationState{
+			Delegate: common.Address{Address: baker},
+			Cycle:    cycle,
+			Balances: common.DelegatedBalances{baker: {StakedBalance: common.NewMutez(1000)}},
+		}, common.DelegationStateVersionReasonFetch))
+		assert.Nil(store.RefreshChangedNetworkStatistics(cycle))
+	}
+
+	statistics, err := store.GetNetworkStatisticsOfCycles([]int64{745, 746, 747})
+	assert.Nil(err)
+	assert.Len(statistics, 2)
+	assert.Equal(int64(746), statistics[746].Cycle)
+	assert.False(statistics[745].TotalBakingPower.IsZero())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/samber/lo"
 	"github.com/tez-capital/protocol-rewards/common"
 	"github.com/tez-capital/protocol-rewards/configuration"
 	"github.com/tez-capital/protocol-rewards/constants"
@@ -19,7 +20,7 @@ type Store struct {
 	config configuration.StorageConfiguration
 }
 
-func NewStore(config *configuration.Runtime) (*Store, error) {
+func openDatabase(config *configuration.Runtime) (*gorm.DB, error) {
 	host, port, user, pass, database := config.Database.Unwrap()
 	slog.Debug("connecting to database", "host", host, "port", port, "user", user, "database", database)
 
@@ -29,25 +30,44 @@ func NewStore(config *configuration.Runtime) (*Store, error) {
 		gormLogger = logger.Default.LogMode(logger.Info)
 	}
 
-	db, err := gorm.Open(postgres.New(postgres.Config{
+	return gorm.Open(postgres.New(postgres.Config{
 		DSN:                  fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai", host, user, pass, database, port),
 		PreferSimpleProtocol: true, // disables implicit prepared statement usage
 	}), &gorm.Config{
 		Logger: gormLogger,
 	})
+}
+
+// applies pending migrations under the migration lock, refuses databases migrated by a newer binary or with modified migrations
+func NewStore(config *configuration.Runtime) (*Store, error) {
+	db, err := openDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	status, err := migrator.status()
 	if err != nil {
 		return nil, err
 	}
-	db.AutoMigrate(&StoredDelegationState{})
+	if status.Pending() {
+		slog.Info("applying pending migrations", "version", status.Current, "latest", status.Latest)
+		if status, err = migrator.migrate(status.Latest); err != nil {
+			return nil, err
+		}
+	}
+	slog.Debug("database schema is up to date", "version", status.Current)
 	return &Store{
 		db:     db,
 		config: config.Storage,
 	}, nil
 }
 
-func (s *Store) GetDelegationState(delegate tezos.Address, cycle int64) (*StoredDelegationState, error) {
-	var state StoredDelegationState
-	if err := s.db.Model(&StoredDelegationState{}).Where("delegate = ? AND cycle = ?", delegate, cycle).First(&state).Error; err != nil {
+func (s *Store) GetDelegationState(delegate tezos.Address, cycle int64) (*common.StoredDelegationState, error) {
+	var state common.StoredDelegationState
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("delegate = ? AND cycle = ?", delegate, cycle).First(&state).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.Join(constants.ErrNotFound, err)
 		}
@@ -56,17 +76,49 @@ func (s *Store) GetDelegationState(delegate tezos.Address, cycle int64) (*Stored
 	return &state, nil
 }
 
-func (s *Store) StoreDelegationState(state *StoredDelegationState) error {
-	// update if exists
-	if result := s.db.Model(&StoredDelegationState{}).Where("delegate = ? AND cycle = ?", state.Delegate, state.Cycle).Updates(state); result.RowsAffected > 0 && result.Error == nil {
-		return nil
+func (s *Store) GetDelegationStates(delegates []tezos.Address, cycles []int64) ([]common.StoredDelegationState, error) {
+	var states []common.StoredDelegationState
+	if len(delegates) == 0 || len(cycles) == 0 {
+		return states, nil
 	}
 
-	slog.Debug("storing delegation state", "delegate", state.Delegate.String(), "cycle", state.Cycle)
-	if err := s.db.Create(state).Error; err != nil {
-		return err
+	addresses := lo.Map(delegates, func(delegate tezos.Address, _ int) common.Address {
+		return common.Address{Address: delegate}
+	})
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("delegate IN ? AND cycle IN ?", addresses, cycles).Find(&states).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	return states, nil
+}
+
+func (s *Store) GetDelegationStateHistory(delegate tezos.Address, fromCycle, toCycle int64) ([]common.StoredDelegationState, error) {
+	var states []common.StoredDelegationState
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("delegate = ? AND cycle >= ? AND cycle <= ?", common.Address{Address: delegate}, fromCycle, toCycle).Order("cycle asc").Find(&states).Error; err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (s *Store) GetDelegationStateDiff(delegate tezos.Address, cycleA, cycleB int64) (*common.DelegationStateDiff, error) {
+	states, err := s.GetDelegationStates([]tezos.Address{delegate}, []int64{cycleA, cycleB})
+	if err != nil {
+		return nil, err
+	}
+
+	stateA, okA := lo.Find(states, func(state common.StoredDelegationState) bool { return state.Cycle == cycleA })
+	stateB, okB := lo.Find(states, func(state common.StoredDelegationState) bool { return state.Cycle == cycleB })
+	if !okA || !okB {
+		return nil, constants.ErrNotFound
+	}
+	return common.DiffDelegationStates(&stateA, &stateB), nil
+}
+
+// previous versions of the state are kept, see StoredDelegationStateVersion
+func (s *Store) StoreDelegationState(state *common.StoredDelegationState, reason common.DelegationStateVersionReason) error {
+	slog.Debug("storing delegation state", "delegate", state.Delegate.String(), "cycle", state.Cycle, "reason", reason)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return storeDelegationStateVersion(tx, state, reason)
+	})
 }
 
 func (s *Store) PruneDelegationState(cycle int64) error {
@@ -76,21 +128,39 @@ func (s *Store) PruneDelegationState(cycle int64) error {
 
 	prunedCycle := cycle - int64(s.config.StoredCycles)
 
-	state := &StoredDelegationState{}
+	state := &common.StoredDelegationState{}
 	slog.Debug("pruning delegation states smaller than", "cycle", prunedCycle)
-	return s.db.Model(&StoredDelegationState{}).Where("cycle < ?", prunedCycle).Delete(state).Error
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("cycle < ?", prunedCycle).Delete(state).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&StoredDelegationStateVersion{}).Where("cycle < ?", prunedCycle).Delete(&StoredDelegationStateVersion{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&StoredNetworkStatistics{}).Where("cycle < ?", prunedCycle).Delete(&StoredNetworkStatistics{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&common.StoredDelegateFetch{}).Where("cycle < ?", prunedCycle).Delete(&common.StoredDelegateFetch{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&common.StoredStakerBalance{}).Where("cycle < ?", prunedCycle).Delete(&common.StoredStakerBalance{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&common.StoredUnstakeRequest{}).Where("finalized_cycle < ?", prunedCycle).Delete(&common.StoredUnstakeRequest{}).Error; err != nil {
+		return err
+	}
+	return s.db.Model(&StoredCycleFetch{}).Where("cycle < ?", prunedCycle).Delete(&StoredCycleFetch{}).Error
 
 }
 
 func (s *Store) IsDelegationStateAvailable(delegate tezos.Address, cycle int64) (bool, error) {
 	var count int64
-	s.db.Model(&StoredDelegationState{}).Where("delegate = ? AND cycle = ?", delegate, cycle).Count(&count)
+	s.db.Model(&common.StoredDelegationState{}).Where("delegate = ? AND cycle = ?", delegate, cycle).Count(&count)
 	return count > 0, nil
 }
 
 func (s *Store) Statistics(cycle int64) (*common.CycleStatistics, error) {
-	var states []StoredDelegationState
-	if err := s.db.Model(&StoredDelegationState{}).Where("cycle = ?", cycle).Find(&states).Error; err != nil {
+	var states []common.StoredDelegationState
+	if err := s.db.Model(&common.StoredDelegationState{}).Where("cycle = ?", cycle).Find(&states).Error; err != nil {
 		return nil, err
 	}
 
@@ -100,28 +170,7 @@ func (s *Store) Statistics(cycle int64) (*common.CycleStatistics, error) {
 	}
 
 	for _, state := range states {
-		ownStaked := int64(0)
-		ownDelegated := int64(0)
-		externalStaked := int64(0)
-		externalDelegated := int64(0)
-
-		for addr, balances := range state.Balances {
-			switch {
-			case addr.Equal(state.Delegate.Address):
-				ownDelegated += balances.DelegatedBalance
-				ownStaked += balances.StakedBalance
-			default:
-				externalStaked += balances.StakedBalance
-				externalDelegated += balances.DelegatedBalance
-			}
-		}
-
-		result.Delegates[state.Delegate.Address] = common.DelegateCycleStatistics{
-			OwnStaked:         ownStaked,
-			OwnDelegated:      ownDelegated,
-			ExternalStaked:    externalStaked,
-			ExternalDelegated: externalDelegated,
-		}
+		result.Delegates[state.Delegate.Address] = state.Statistics()
 	}
 
 	return result, nil
@@ -130,7 +179,16 @@ func (s *Store) Statistics(cycle int64) (*common.CycleStatistics, error) {
 func (s *Store) GetLastFetchedCycle() (int64, error) {
 	var cycle int64
 
-	if err := s.db.Model(&StoredDelegationState{}).Select("cycle").Order("cycle desc").First(&cycle).Error; err != nil {
+	// prefer explicit fetch records, partially fetched cycles are not considered fetched
+	var records int64
+	if err := s.db.Model(&StoredCycleFetch{}).Count(&records).Error; err != nil {
+		return 0, err
+	}
+	if records > 0 {
+		return s.GetLastFinishedCycle()
+	}
+
+	if err := s.db.Model(&common.StoredDelegationState{}).Select("cycle").Order("cycle desc").First(&cycle).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return 0, nil
 		}
@@ -138,3 +196,50 @@ func (s *Store) GetLastFetchedCycle() (int64, error) {
 	}
 	return cycle, nil
 }
+
+// last block of a cycle as recorded with its delegation states
+type CycleLastBlock struct {
+	Cycle          int64  `json:"cycle"`
+	LastBlockLevel int64  `json:"last_block_level"`
+	LastBlockHash  string `json:"last_block_hash"`
+}
+
+// last blocks recorded with states of cycles starting from the given one
+func (s *Store) GetRecordedLastBlocks(fromCycle int64) ([]CycleLastBlock, error) {
+	var blocks []CycleLastBlock
+	if err := s.db.Model(&common.StoredDelegationState{}).
+		Distinct("cycle", "last_block_level", "last_block_hash").
+		Where("cycle >= ? AND last_block_hash <> ''", fromCycle).
+		Order("cycle asc").
+		Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// removes states computed from the block which is no longer part of the canonical chain,
+// their delegates are pending again and the cycle fetch is unfinished until they are refetched
+func (s *Store) InvalidateDelegationStates(cycle int64, lastBlockHash string) error {
+	slog.Debug("invalidating delegation states", "cycle", cycle, "last_block_hash", lastBlockHash)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// versions are kept, none of them is current until the state is refetched
+		invalidated := tx.Model(&common.StoredDelegationState{}).Select("delegate").Where("cycle = ? AND last_block_hash = ?", cycle, lastBlockHash)
+		if err := tx.Model(&StoredDelegationStateVersion{}).Where("cycle = ? AND is_current AND delegate IN (?)", cycle, invalidated).Update("is_current", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&common.StoredDelegateFetch{}).Where("cycle = ? AND delegate IN (?)", cycle, invalidated).Updates(map[string]interface{}{
+			"status":        common.DelegateFetchStatusPending,
+			"error":         "",
+			"next_retry_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&StoredCycleFetch{}).Where("cycle = ?", cycle).Updates(map[string]interface{}{
+			"finished":    false,
+			"finished_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("cycle = ? AND last_block_hash = ?", cycle, lastBlockHash).Delete(&common.StoredDelegationState{}).Error
+	})
+}
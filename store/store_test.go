@@ -0,0 +1,42 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tez-capital/protocol-rewards/configuration"
+	"github.com/tez-capital/protocol-rewards/constants"
+)
+
+// store on the database configured through TEST_DATABASE_* env variables, the test is skipped without it
+func newTestStore(t *testing.T) *Store {
+	host := os.Getenv("TEST_DATABASE_HOST")
+	if host == "" {
+		t.Skip("TEST_DATABASE_HOST not set")
+	}
+	envOr := func(key, fallback string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return fallback
+	}
+	config := &configuration.Runtime{
+		Database: configuration.DatabaseConfiguration{
+			Host:     host,
+			Port:     envOr("TEST_DATABASE_PORT", "5432"),
+			User:     envOr("TEST_DATABASE_USER", "postgres"),
+			Password: os.Getenv("TEST_DATABASE_PASSWORD"),
+			Database: envOr("TEST_DATABASE_NAME", "postgres"),
+		},
+	}
+
+	_, err := Migrate(config, constants.MIGRATE_UP)
+	assert.Nil(t, err)
+	store, err := NewStore(config)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Nil(t, store.db.Exec("TRUNCATE stored_delegation_states, stored_delegation_state_versions, stored_cycle_fetches, stored_delegate_fetches, stored_network_statistics").Error)
+	return store
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/tez-capital/protocol-rewards/common"
+	"github.com/tez-capital/protocol-rewards/constants"
+	"github.com/trilitech/tzgo/tezos"
+	"gorm.io/gorm"
+)
+
+type DelegationStateVersionPayload common.StoredDelegationState
+
+func (j DelegationStateVersionPayload) Value() (driver.Value, error) {
+	result, err := json.Marshal(j)
+	return string(result), err
+}
+
+func (j *DelegationStateVersionPayload) Scan(src interface{}) error {
+	if srcTmp, ok := src.(string); ok {
+		src = []byte(srcTmp)
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	return json.Unmarshal(source, j)
+}
+
+// every computed state is kept, the current one is also stored as common.StoredDelegationState
+type StoredDelegationStateVersion struct {
+	Delegate                          common.Address `gorm:"primaryKey"`
+	Cycle                             int64          `gorm:"primaryKey"`
+	common.DelegationStateVersionInfo `gorm:"embedded"`
+	State                             DelegationStateVersionPayload `gorm:"type:jsonb;default:'{}'"`
+}
+
+func newDelegationStateVersion(state *common.StoredDelegationState, reason common.DelegationStateVersionReason, storedAt time.Time) *StoredDelegationStateVersion {
+	return &StoredDelegationStateVersion{
+		Delegate: state.Delegate,
+		Cycle:    state.Cycle,
+		DelegationStateVersionInfo: common.DelegationStateVersionInfo{
+			Version:      state.Version,
+			Current:      true,
+			Reason:       reason,
+			StoredAt:     storedAt,
+			Status:       state.Status,
+			BalancesHash: state.Balances.Hash(),
+		},
+		State: DelegationStateVersionPayload(*state),
+	}
+}
+
+// records the state as a new current version and replaces the stored state
+func storeDelegationStateVersion(tx *gorm.DB, state *common.StoredDelegationState, reason common.DelegationStateVersionReason) error {
+	var latest int64
+	if err := tx.Model(&StoredDelegationStateVersion{}).Select("COALESCE(MAX(version), 0)").Where("delegate = ? AND cycle = ?", state.Delegate, state.Cycle).Scan(&latest).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&StoredDelegationStateVersion{}).Where("delegate = ? AND cycle = ? AND is_current", state.Delegate, state.Cycle).Update("is_current", false).Error; err != nil {
+		return err
+	}
+	state.Version = latest + 1
+	if err := tx.Create(newDelegationStateVersion(state, reason, time.Now())).Error; err != nil {
+		return err
+	}
+	return tx.Save(state).Error
+}
+
+func (s *Store) GetDelegationStateVersions(delegate tezos.Address, cycle int64) ([]common.DelegationStateVersionInfo, error) {
+	versions := []common.DelegationStateVersionInfo{}
+	if err := s.db.Model(&StoredDelegationStateVersion{}).Where("delegate = ? AND cycle = ?", common.Address{Address: delegate}, cycle).Order("version asc").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *Store) GetDelegationStateVersion(delegate tezos.Address, cycle, version int64) (*common.StoredDelegationState, error) {
+	var record StoredDelegationStateVersion
+	if err := s.db.Model(&StoredDelegationStateVersion{}).Where("delegate = ? AND cycle = ? AND version = ?", common.Address{Address: delegate}, cycle, version).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Join(constants.ErrNotFound, err)
+		}
+		return nil, err
+	}
+	state := common.StoredDelegationState(record.State)
+	return &state, nil
+}
+
+func (s *Store) GetDelegationStateVersionDiff(delegate tezos.Address, cycle, versionA, versionB int64) (*common.DelegationStateVersionDiff, error) {
+	stateA, err := s.GetDelegationStateVersion(delegate, cycle, versionA)
+	if err != nil {
+		return nil, err
+	}
+	stateB, err := s.GetDelegationStateVersion(delegate, cycle, versionB)
+	if err != nil {
+		return nil, err
+	}
+	return common.DiffDelegationStateVersions(stateA, stateB), nil
+}